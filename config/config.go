@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
@@ -14,12 +15,15 @@ import (
 var embeddedConfig embed.FS
 
 type Config struct {
-	App     AppConfig     `mapstructure:"app"`
-	Metrics MetricsConfig `mapstructure:"metrics"`
-	DB      DBConfig      `mapstructure:"db"`
-	Cache   CacheConfig   `mapstructure:"cache"`
-	Tracing TracingConfig `mapstructure:"tracing"`
-	Logger  LoggerConfig  `mapstructure:"logger"`
+	App         AppConfig         `mapstructure:"app"`
+	Admin       AdminConfig       `mapstructure:"admin"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	DB          DBConfig          `mapstructure:"db"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	Users       UsersConfig       `mapstructure:"users"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
+	Logger      LoggerConfig      `mapstructure:"logger"`
 }
 
 type DBConfig struct {
@@ -28,6 +32,12 @@ type DBConfig struct {
 	Host     string
 	Port     string
 	Name     string
+	// CountEstimateAbove switches unfiltered user counts to the planner's
+	// estimate once the table has more rows than this. Zero disables it.
+	CountEstimateAbove int64 `mapstructure:"count_estimate_above"`
+	// ExportTimeout bounds how long a user export may hold its connection
+	// and snapshot, however slowly the client reads. Zero disables it.
+	ExportTimeout time.Duration `mapstructure:"export_timeout"`
 }
 
 type LoggerConfig struct {
@@ -37,12 +47,92 @@ type LoggerConfig struct {
 // without mapstructure tag configs doesn't work in app.go
 
 type CacheConfig struct {
-	ExpirationMinutes time.Duration `mapstructure:"expiration_minutes"`
-	CleanupMinutes    time.Duration `mapstructure:"cleanup_minutes"`
+	ExpirationMinutes time.Duration      `mapstructure:"expiration_minutes"`
+	CleanupMinutes    time.Duration      `mapstructure:"cleanup_minutes"`
+	PageTTL           time.Duration      `mapstructure:"page_ttl"`
+	NegativeTTL       time.Duration      `mapstructure:"negative_ttl"`
+	RefreshAhead      time.Duration      `mapstructure:"refresh_ahead"`
+	StaleGrace        time.Duration      `mapstructure:"stale_grace"`
+	LoadTimeout       time.Duration      `mapstructure:"load_timeout"`
+	MaxEntries        int                `mapstructure:"max_entries"`
+	MaxBytes          int64              `mapstructure:"max_bytes"`
+	Shards            int                `mapstructure:"shards"`
+	WarmUp            int                `mapstructure:"warm_up"`
+	SnapshotPath      string             `mapstructure:"snapshot_path"`
+	EvictionPolicy    string             `mapstructure:"eviction_policy"`
+	Backend           string             `mapstructure:"backend"`
+	RESP              RESPConfig         `mapstructure:"resp"`
+	Invalidation      InvalidationConfig `mapstructure:"invalidation"`
+}
+
+// IdempotencyConfig sets how long Idempotency-Keys are kept, and how often
+// the expired ones are deleted. A key whose request neither completed nor
+// failed within Lease is given to the next request that uses it.
+type IdempotencyConfig struct {
+	TTL             time.Duration `mapstructure:"ttl"`
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+	Lease           time.Duration `mapstructure:"lease"`
+}
+
+// Validate reports settings the key cleanup cannot run with.
+func (c IdempotencyConfig) Validate() error {
+	if c.TTL <= 0 {
+		return errors.Errorf("idempotency.ttl must be positive, got %s", c.TTL)
+	}
+	if c.CleanupInterval <= 0 {
+		return errors.Errorf("idempotency.cleanup_interval must be positive, got %s", c.CleanupInterval)
+	}
+	if c.Lease < 0 {
+		return errors.Errorf("idempotency.lease must not be negative, got %s", c.Lease)
+	}
+	return nil
+}
+
+// UsersConfig sets when soft-deleted users are purged for good: those
+// deleted more than PurgeAfterDays ago, checked every PurgeInterval. Zero
+// days keeps deleted users forever.
+type UsersConfig struct {
+	PurgeAfterDays int           `mapstructure:"purge_after_days"`
+	PurgeInterval  time.Duration `mapstructure:"purge_interval"`
+}
+
+// Validate reports settings the purge cannot run with.
+func (c UsersConfig) Validate() error {
+	if c.PurgeAfterDays < 0 {
+		return errors.Errorf("users.purge_after_days must not be negative, got %d", c.PurgeAfterDays)
+	}
+	if c.PurgeAfterDays > 0 && c.PurgeInterval <= 0 {
+		return errors.Errorf("users.purge_interval must be positive, got %s", c.PurgeInterval)
+	}
+	return nil
+}
+
+type InvalidationConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	MinBackoff time.Duration `mapstructure:"min_backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+type RESPConfig struct {
+	Addr        string        `mapstructure:"addr"`
+	Password    string        `mapstructure:"password"`
+	DB          int           `mapstructure:"db"`
+	PoolSize    int           `mapstructure:"pool_size"`
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+	Timeout     time.Duration `mapstructure:"timeout"`
 }
 
 type AppConfig struct {
 	Port string
+	// CursorSecret signs pagination cursors. It must be shared by all
+	// replicas; when empty each process signs with a random key.
+	CursorSecret string `mapstructure:"cursor_secret"`
+}
+
+// AdminConfig configures the operator API. It is served on its own port so
+// it can be kept off the public network; an empty port disables it.
+type AdminConfig struct {
+	Port string
 }
 
 type MetricsConfig struct {
@@ -0,0 +1,42 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied.
+-- Every statement that changes users publishes the changed ids, up to 100
+-- per notification to stay well below the 8000 byte payload limit, together
+-- with the application_name of the session that ran it so a replica can
+-- skip its own writes. Transition tables need one trigger per event.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION notify_users_changed() RETURNS trigger AS $$
+DECLARE
+    origin text := current_setting('application_name');
+    ids    jsonb;
+BEGIN
+    FOR ids IN
+        SELECT jsonb_agg(id::text)
+        FROM (SELECT id, (row_number() OVER () - 1) / 100 AS chunk FROM changed_users) AS numbered
+        GROUP BY chunk
+    LOOP
+        PERFORM pg_notify('users_changed', jsonb_build_object('origin', origin, 'ids', ids)::text);
+    END LOOP;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER users_inserted
+    AFTER INSERT ON users REFERENCING NEW TABLE AS changed_users
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_users_changed();
+
+CREATE TRIGGER users_updated
+    AFTER UPDATE ON users REFERENCING NEW TABLE AS changed_users
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_users_changed();
+
+CREATE TRIGGER users_deleted
+    AFTER DELETE ON users REFERENCING OLD TABLE AS changed_users
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_users_changed();
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back.
+DROP TRIGGER IF EXISTS users_inserted ON users;
+DROP TRIGGER IF EXISTS users_updated ON users;
+DROP TRIGGER IF EXISTS users_deleted ON users;
+DROP FUNCTION IF EXISTS notify_users_changed();
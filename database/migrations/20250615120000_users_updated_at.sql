@@ -0,0 +1,25 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied.
+ALTER TABLE users ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX users_updated_at_idx ON users (updated_at DESC);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION touch_users_updated_at() RETURNS trigger AS $$
+BEGIN
+    NEW.updated_at = now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER users_touch_updated_at
+    BEFORE UPDATE ON users
+    FOR EACH ROW EXECUTE FUNCTION touch_users_updated_at();
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back.
+DROP TRIGGER IF EXISTS users_touch_updated_at ON users;
+DROP FUNCTION IF EXISTS touch_users_updated_at();
+DROP INDEX IF EXISTS users_updated_at_idx;
+ALTER TABLE users DROP COLUMN updated_at;
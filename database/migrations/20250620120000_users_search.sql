@@ -0,0 +1,23 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- unaccent() is only STABLE because its dictionary can change; pinning the
+-- dictionary makes it safe to use in a generated column and an index.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION users_search_text(text) RETURNS text
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE STRICT AS $$
+    SELECT lower(public.unaccent('public.unaccent'::regdictionary, $1))
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE users ADD COLUMN search_name TEXT GENERATED ALWAYS AS (users_search_text(name)) STORED;
+
+CREATE INDEX users_search_name_trgm_idx ON users USING GIN (search_name gin_trgm_ops);
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back.
+DROP INDEX IF EXISTS users_search_name_trgm_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS search_name;
+DROP FUNCTION IF EXISTS users_search_text(text);
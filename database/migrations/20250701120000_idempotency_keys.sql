@@ -0,0 +1,18 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied.
+-- A key is reserved with a NULL status while its first request runs, and
+-- holds the response to replay once that request has succeeded.
+CREATE TABLE idempotency_keys (
+    key          TEXT PRIMARY KEY,
+    fingerprint  BYTEA NOT NULL,
+    status       INT,
+    content_type TEXT,
+    response     BYTEA,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back.
+DROP TABLE IF EXISTS idempotency_keys;
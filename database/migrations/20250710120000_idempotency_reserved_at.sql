@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied.
+-- A reservation whose request never completed nor released the key, e.g.
+-- because the process died, can be taken over once reserved_at is older
+-- than the lease.
+ALTER TABLE idempotency_keys ADD COLUMN reserved_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- +goose Down
+-- SQL in section 'Down' is executed when this migration is rolled back.
+ALTER TABLE idempotency_keys DROP COLUMN reserved_at;
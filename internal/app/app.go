@@ -2,7 +2,10 @@ package app
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -10,6 +13,7 @@ import (
 	"app/config"
 	"app/database"
 	"app/internal/cache"
+	"app/internal/cursor"
 	"app/internal/handler"
 	"app/internal/logger"
 	"app/internal/metrics"
@@ -18,6 +22,8 @@ import (
 	"app/internal/tracing"
 	"app/internal/usecase"
 
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -30,6 +36,12 @@ func Run(ctx context.Context) error {
 	}
 
 	logger.Init(cfg.Logger.Level)
+	if err := cfg.Idempotency.Validate(); err != nil {
+		return errors.Wrap(err, "invalid idempotency config")
+	}
+	if err := cfg.Users.Validate(); err != nil {
+		return errors.Wrap(err, "invalid users config")
+	}
 
 	if err := database.Migrate(cfg.DB.ConnString()); err != nil {
 		slog.Error("Failed to run migrations", "error", err)
@@ -37,7 +49,8 @@ func Run(ctx context.Context) error {
 	}
 
 	slog.Info("Connecting to database", "db_host", cfg.DB.Host, "db_port", cfg.DB.Port)
-	db, err := storage.GetConnect(ctx, cfg.DB.ConnString())
+	origin := replicaName()
+	db, err := storage.GetConnect(ctx, cfg.DB.ConnString(), origin)
 	if err != nil {
 		return errors.Wrap(err, "failed to connect to database")
 	}
@@ -50,18 +63,51 @@ func Run(ctx context.Context) error {
 		}
 	}()
 
-	userRepo := repository.NewUserRepo(db)
-	userCachedRepo := cache.NewDecorator(userRepo, cfg.Cache.ExpirationMinutes)
+	cacheStore, err := cache.NewStore(cfg.Cache)
+	if err != nil {
+		return errors.Wrap(err, "invalid cache config")
+	}
+	if closer, ok := cacheStore.(io.Closer); ok {
+		defer func() {
+			if err := closer.Close(); err != nil {
+				slog.Error("Failed to close cache store", "error", err)
+			}
+		}()
+	}
+	slog.Info("Cache backend selected", "backend", cfg.Cache.Backend)
+
+	userRepo := repository.NewUserRepo(db,
+		repository.WithCountEstimateAbove(cfg.DB.CountEstimateAbove),
+		repository.WithExportTimeout(cfg.DB.ExportTimeout),
+	)
+	userCachedRepo := cache.NewDecorator(userRepo, cfg.Cache.ExpirationMinutes,
+		cache.WithStore(cacheStore),
+		cache.WithPageTTL(cfg.Cache.PageTTL),
+		cache.WithNegativeTTL(cfg.Cache.NegativeTTL),
+		cache.WithRefreshAhead(cfg.Cache.RefreshAhead),
+		cache.WithStaleGrace(cfg.Cache.StaleGrace),
+		cache.WithLoadTimeout(cfg.Cache.LoadTimeout),
+	)
+	warmUpCache(ctx, cfg.Cache, userCachedRepo, userRepo)
 
 	userUC := usecase.NewUserUsecase(userCachedRepo)
-	userHandler := handler.NewHandler(userUC)
-	app := getRouter(userHandler)
+	if cfg.App.CursorSecret == "" {
+		slog.Warn("No cursor secret configured, pagination cursors will not survive a restart or work across replicas")
+	}
+	userHandler := handler.NewHandler(userUC, cursor.NewSigner(cfg.App.CursorSecret))
+	idempotencyRepo := repository.NewIdempotencyRepo(db, cfg.Idempotency.Lease)
+	app := getRouter(userHandler, idempotencyRepo)
 
 	metrics.Register(ctx, cfg.Metrics.Port)
 
 	sigCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	if cfg.Cache.Invalidation.Enabled {
+		listener := cache.NewListener(cfg.DB.ConnString(), origin, userCachedRepo, cfg.Cache.Invalidation)
+		go listener.Run(sigCtx)
+	}
+
 	go func() {
 		ticker := time.NewTicker(cfg.Cache.CleanupMinutes)
 		defer ticker.Stop()
@@ -76,7 +122,12 @@ func Run(ctx context.Context) error {
 		}
 	}()
 
-	serverErr := make(chan error, 1)
+	go expireIdempotencyKeys(sigCtx, cfg.Idempotency, idempotencyRepo)
+	if cfg.Users.PurgeAfterDays > 0 {
+		go purgeDeletedUsers(sigCtx, cfg.Users, userRepo)
+	}
+
+	serverErr := make(chan error, 2)
 	go func() {
 		slog.Info("Starting HTTP server", "port", cfg.App.Port)
 		if err := app.Listen(":" + cfg.App.Port); err != nil {
@@ -84,14 +135,112 @@ func Run(ctx context.Context) error {
 		}
 	}()
 
+	var adminApp *fiber.App
+	if cfg.Admin.Port != "" {
+		adminApp = getAdminRouter(handler.NewAdminHandler(userCachedRepo), userHandler.Admin())
+		go func() {
+			slog.Info("Starting admin HTTP server", "port", cfg.Admin.Port)
+			if err := adminApp.Listen(":" + cfg.Admin.Port); err != nil {
+				serverErr <- errors.Wrap(err, "admin HTTP server failed")
+			}
+		}()
+	}
+
 	select {
 	case <-sigCtx.Done():
 		slog.Info("Shutdown signal received")
 		if err := app.Shutdown(); err != nil {
 			slog.Error("Failed to shutdown server gracefully", "error", err)
 		}
+		if adminApp != nil {
+			if err := adminApp.Shutdown(); err != nil {
+				slog.Error("Failed to shutdown admin server gracefully", "error", err)
+			}
+		}
+		if cfg.Cache.SnapshotPath != "" {
+			n, err := userCachedRepo.SaveSnapshot(ctx, cfg.Cache.SnapshotPath)
+			if err != nil {
+				slog.Error("Failed to save cache snapshot", "path", cfg.Cache.SnapshotPath, "error", err)
+			} else {
+				slog.Info("Cache snapshot saved", "path", cfg.Cache.SnapshotPath, "entries", n)
+			}
+		}
 		return nil
 	case err := <-serverErr:
 		return err
 	}
 }
+
+// warmUpCache fills the user cache before the server starts taking traffic:
+// first from the snapshot left by the previous run, then with the most
+// recently updated users. Failures only cost a colder start.
+func warmUpCache(ctx context.Context, cfg config.CacheConfig, c *cache.Decorator, repo *repository.UserRepo) {
+	if cfg.SnapshotPath != "" {
+		n, err := c.LoadSnapshot(ctx, cfg.SnapshotPath, repo)
+		if err != nil {
+			slog.Warn("Failed to load cache snapshot", "path", cfg.SnapshotPath, "error", err)
+		} else {
+			slog.Info("Cache snapshot loaded", "path", cfg.SnapshotPath, "entries", n)
+		}
+	}
+	if cfg.WarmUp > 0 {
+		n, err := c.WarmUp(ctx, repo, cfg.WarmUp)
+		if err != nil {
+			slog.Warn("Failed to warm up cache", "error", err)
+		} else {
+			slog.Info("Cache warmed up", "users", n)
+		}
+	}
+}
+
+// replicaName identifies this process in the sessions it opens, and so in the
+// change notifications for its writes. It is kept under the 63 bytes the
+// server keeps of an application_name.
+func replicaName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "app"
+	}
+	return fmt.Sprintf("%.40s-%s", host, uuid.NewString()[:8])
+}
+
+// expireIdempotencyKeys deletes the Idempotency-Keys older than the TTL
+// every cleanup interval until ctx is done.
+func expireIdempotencyKeys(ctx context.Context, cfg config.IdempotencyConfig, repo *repository.IdempotencyRepo) {
+	ticker := time.NewTicker(cfg.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := repo.DeleteExpired(ctx, cfg.TTL)
+			if err != nil {
+				slog.Warn("Failed to delete expired idempotency keys", "error", err)
+			} else if n > 0 {
+				slog.Info("Expired idempotency keys deleted", "keys", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// purgeDeletedUsers permanently removes the users soft-deleted more than
+// the configured number of days ago, every purge interval until ctx is done.
+func purgeDeletedUsers(ctx context.Context, cfg config.UsersConfig, repo *repository.UserRepo) {
+	age := time.Duration(cfg.PurgeAfterDays) * 24 * time.Hour
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := repo.PurgeDeleted(ctx, age)
+			if err != nil {
+				slog.Warn("Failed to purge deleted users", "purged", n, "error", err)
+			} else if n > 0 {
+				slog.Info("Deleted users purged", "users", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
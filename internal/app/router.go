@@ -7,15 +7,44 @@ import (
 	fiber "github.com/gofiber/fiber/v2"
 )
 
-func getRouter(h handler.UserHandler) *fiber.App {
-	app := fiber.New()
+// importPath streams its body, so it is exempt from the body limit.
+const importPath = "/users/import"
+
+func getRouter(h handler.UserHandler, keys middleware.IdempotencyStore) *fiber.App {
+	app := fiber.New(fiber.Config{
+		StreamRequestBody: true,
+		ErrorHandler:      handler.ErrorHandler,
+	})
 
 	app.Use(middleware.Middleware())
-	app.Post("/user", h.CreateUser)
+	app.Use(middleware.BodyLimit(fiber.DefaultBodyLimit, importPath))
+	app.Post("/user", middleware.Idempotency(keys), h.CreateUser)
 	app.Put("/user", h.UpdateUser)
 	app.Get("/user/:id", h.GetUser)
+	app.Put("/user/:id", h.UpsertUser)
+	app.Patch("/user/:id", h.PatchUser)
 	app.Delete("/user/:id", h.DeleteUser)
+	app.Post("/user/:id/restore", h.RestoreUser)
 	app.Get("/users", h.GetAllUsers)
+	app.Get("/users/search", h.SearchUsers)
+	app.Post("/users/bulk", h.CreateUsers)
+	app.Put("/users/bulk", h.UpdateUsers)
+	app.Delete("/users/bulk", h.DeleteUsers)
+	app.Post(importPath, h.ImportUsers)
+	app.Get("/users/export", h.ExportUsers)
+
+	return app
+}
+
+func getAdminRouter(h handler.CacheAdminHandler, users handler.UserHandler) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: handler.ErrorHandler})
+
+	app.Use(middleware.Middleware())
+	app.Get("/cache/stats", h.CacheStats)
+	app.Get("/cache/users/:id", h.InspectCachedUser)
+	app.Delete("/cache/users/:id", h.PurgeCachedUser)
+	app.Delete("/cache/users", h.PurgeCache)
+	app.Get("/users", users.GetAllUsers)
 
 	return app
 }
@@ -4,6 +4,121 @@ import (
 	"errors"
 )
 
+// Kind classifies an Error. The transport layer maps kinds to responses;
+// errors that are not an Error count as KindInternal.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindConflict
+	KindValidation
+	KindPreconditionFailed
+	KindUnavailable
+	// KindUnprocessable is a well-formed request that cannot be carried out
+	// as asked, e.g. a patch that leaves an invalid user.
+	KindUnprocessable
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not_found"
+	case KindConflict:
+		return "conflict"
+	case KindValidation:
+		return "validation"
+	case KindPreconditionFailed:
+		return "precondition_failed"
+	case KindUnavailable:
+		return "unavailable"
+	case KindUnprocessable:
+		return "unprocessable"
+	default:
+		return "internal"
+	}
+}
+
+// Error is an application error. Detail and Fields are written for the
+// client; the cause is only ever logged.
+type Error struct {
+	Kind   Kind
+	Detail string
+	Fields []FieldError
+	cause  error
+}
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Detail + ": " + e.cause.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is matches any Error of the same kind, so errors.Is(err, ErrNotFound)
+// holds for every not-found error whatever its detail.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind
+}
+
+// WithCause returns a copy of e that wraps cause for logging.
+func (e *Error) WithCause(cause error) *Error {
+	c := *e
+	c.cause = cause
+	return &c
+}
+
+func NotFound(detail string) *Error {
+	return &Error{Kind: KindNotFound, Detail: detail}
+}
+
+func Conflict(detail string) *Error {
+	return &Error{Kind: KindConflict, Detail: detail}
+}
+
+func Validation(detail string, fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Detail: detail, Fields: fields}
+}
+
+func PreconditionFailed(detail string) *Error {
+	return &Error{Kind: KindPreconditionFailed, Detail: detail}
+}
+
+func Unavailable(detail string) *Error {
+	return &Error{Kind: KindUnavailable, Detail: detail}
+}
+
+func Unprocessable(detail string, fields ...FieldError) *Error {
+	return &Error{Kind: KindUnprocessable, Detail: detail, Fields: fields}
+}
+
+// KindOf returns the kind of the first Error in err's chain.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound           = NotFound("not found")
+	ErrConflict           = Conflict("conflict")
+	ErrPreconditionFailed = PreconditionFailed("precondition failed")
+	ErrUnavailable        = Unavailable("unavailable")
+	// ErrAborted marks bulk items that were valid but not applied because
+	// another item of an all-or-nothing request failed.
+	ErrAborted = errors.New("aborted")
 )
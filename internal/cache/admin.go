@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"app/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+// ageBuckets are the upper bounds of the entry age histogram. Entries older
+// than the last bound land in a final open-ended bucket.
+var ageBuckets = []time.Duration{
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+}
+
+// Stats describes what an entity cache currently holds and how well it has
+// performed since the process started.
+type Stats struct {
+	Entries         int         `json:"entries"`
+	NotFoundEntries int         `json:"not_found_entries"`
+	StaleEntries    int         `json:"stale_entries"`
+	Hits            uint64      `json:"hits"`
+	Misses          uint64      `json:"misses"`
+	HitRatio        float64     `json:"hit_ratio"`
+	AgeHistogram    []AgeBucket `json:"age_histogram"`
+}
+
+// AgeBucket counts entries stored at most UpTo ago. The last bucket has an
+// UpTo of "+Inf".
+type AgeBucket struct {
+	UpTo  string `json:"le"`
+	Count int    `json:"count"`
+}
+
+// EntryInfo is one cached entry as seen by an operator.
+type EntryInfo[V any] struct {
+	Value     V         `json:"value,omitempty"`
+	NotFound  bool      `json:"not_found"`
+	Stale     bool      `json:"stale"`
+	StoredAt  time.Time `json:"stored_at"`
+	FreshTill time.Time `json:"fresh_till"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Stats scans the store for this entity's entries.
+func (e *Entity[K, V]) Stats(ctx context.Context) (Stats, error) {
+	hits, misses := e.hits.Load(), e.misses.Load()
+	stats := Stats{
+		Hits:         hits,
+		Misses:       misses,
+		AgeHistogram: make([]AgeBucket, len(ageBuckets)+1),
+	}
+	if total := hits + misses; total > 0 {
+		stats.HitRatio = float64(hits) / float64(total)
+	}
+	for i, bound := range ageBuckets {
+		stats.AgeHistogram[i].UpTo = bound.String()
+	}
+	stats.AgeHistogram[len(ageBuckets)].UpTo = "+Inf"
+
+	now := time.Now()
+	err := e.store.Range(ctx, e.prefix, func(_ string, data []byte) bool {
+		var entry entityEntry[V]
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return true
+		}
+		stats.Entries++
+		if entry.NotFound {
+			stats.NotFoundEntries++
+		}
+		if !entry.fresh(now) {
+			stats.StaleEntries++
+		}
+		stats.AgeHistogram[ageBucket(now.Sub(entry.StoredAt))].Count++
+		return true
+	})
+	if err != nil {
+		return Stats{}, errors.Wrapf(err, "scan %s cache", e.cfg.Name)
+	}
+	return stats, nil
+}
+
+func ageBucket(age time.Duration) int {
+	for i, bound := range ageBuckets {
+		if age <= bound {
+			return i
+		}
+	}
+	return len(ageBuckets)
+}
+
+// Inspect returns the cached entry for key without loading it from the
+// repository or counting a hit.
+func (e *Entity[K, V]) Inspect(ctx context.Context, key K) (EntryInfo[V], bool, error) {
+	data, ok, err := e.store.Get(ctx, e.storeKey(key))
+	if err != nil || !ok {
+		return EntryInfo[V]{}, false, err
+	}
+	var entry entityEntry[V]
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return EntryInfo[V]{}, false, errors.Wrapf(err, "decode %s cache entry", e.cfg.Name)
+	}
+
+	info := EntryInfo[V]{
+		Value:     entry.Value,
+		NotFound:  entry.NotFound,
+		Stale:     !entry.fresh(time.Now()),
+		StoredAt:  entry.StoredAt,
+		FreshTill: entry.FreshTill,
+	}
+	ttl, ok, err := e.store.TTL(ctx, e.storeKey(key))
+	if err != nil {
+		return EntryInfo[V]{}, false, err
+	}
+	if !ok {
+		return EntryInfo[V]{}, false, nil
+	}
+	if ttl > 0 {
+		info.ExpiresAt = time.Now().Add(ttl)
+	}
+	return info, true, nil
+}
+
+// Stats reports on the cached users.
+func (c *Decorator) Stats(ctx context.Context) (Stats, error) {
+	return c.users.Stats(ctx)
+}
+
+// Inspect returns the cached entry for a user, if any.
+func (c *Decorator) Inspect(ctx context.Context, id string) (EntryInfo[*models.User], bool, error) {
+	return c.users.Inspect(ctx, id)
+}
+
+// Purge drops one cached user.
+func (c *Decorator) Purge(ctx context.Context, id string) {
+	c.Invalidate(ctx, id)
+}
+
+// PurgeAll drops every cached user and list page.
+func (c *Decorator) PurgeAll(ctx context.Context) error {
+	return c.Flush(ctx)
+}
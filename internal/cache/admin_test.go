@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"app/internal/apperr"
+	"app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecorator_Stats(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Minute, WithNegativeTTL(time.Minute))
+
+	cache.set(ctx, &models.User{ID: "1", Name: "Alice"})
+	cache.set(ctx, &models.User{ID: "2", Name: "Bob"})
+	mockRepo.On("Get", mock.Anything, "3").Return(nil, apperr.ErrNotFound).Once()
+
+	_, err := cache.Get(ctx, "1")
+	require.NoError(t, err)
+	_, err = cache.Get(ctx, "3")
+	require.ErrorIs(t, err, apperr.ErrNotFound)
+
+	stats, err := cache.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Entries)
+	assert.Equal(t, 1, stats.NotFoundEntries)
+	assert.Zero(t, stats.StaleEntries)
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.InDelta(t, 0.5, stats.HitRatio, 1e-9)
+
+	require.Len(t, stats.AgeHistogram, len(ageBuckets)+1)
+	assert.Equal(t, "10s", stats.AgeHistogram[0].UpTo)
+	assert.Equal(t, 3, stats.AgeHistogram[0].Count)
+	assert.Equal(t, "+Inf", stats.AgeHistogram[len(ageBuckets)].UpTo)
+}
+
+func TestDecorator_Stats_IgnoresPages(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Minute, WithPageTTL(time.Minute))
+
+	mockRepo.On("GetAll", mock.Anything, firstPage).Return([]*models.User{{ID: "1"}}, nil).Once()
+	_, err := cache.GetAll(ctx, firstPage)
+	require.NoError(t, err)
+
+	stats, err := cache.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Entries)
+}
+
+func TestDecorator_Inspect(t *testing.T) {
+	ctx := context.Background()
+	cache := NewDecorator(new(MockUserProvider), time.Minute, WithStaleGrace(time.Minute))
+
+	_, ok, err := cache.Inspect(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	before := time.Now()
+	cache.set(ctx, &models.User{ID: "1", Name: "Alice"})
+
+	info, ok, err := cache.Inspect(ctx, "1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "Alice", info.Value.Name)
+	assert.False(t, info.NotFound)
+	assert.False(t, info.Stale)
+	assert.WithinDuration(t, before.Add(time.Minute), info.FreshTill, time.Second)
+	assert.WithinDuration(t, before.Add(2*time.Minute), info.ExpiresAt, time.Second)
+
+	stats, err := cache.Stats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Hits, "inspecting must not count as a hit")
+}
+
+func TestDecorator_PurgeAndPurgeAll(t *testing.T) {
+	ctx := context.Background()
+	cache := NewDecorator(new(MockUserProvider), time.Minute)
+
+	cache.set(ctx, &models.User{ID: "1"})
+	cache.set(ctx, &models.User{ID: "2"})
+	cache.set(ctx, &models.User{ID: "3"})
+
+	cache.Purge(ctx, "1")
+	_, ok := cache.get(ctx, "1")
+	assert.False(t, ok)
+	_, ok = cache.get(ctx, "2")
+	assert.True(t, ok)
+
+	require.NoError(t, cache.PurgeAll(ctx))
+	stats, err := cache.Stats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Entries)
+}
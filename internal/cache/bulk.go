@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+
+	"app/internal/models"
+	"app/internal/tracing"
+)
+
+// CreateMany caches every user that was created. Pages are dropped once for
+// the whole batch.
+func (c *Decorator) CreateMany(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	ctx, span := tracing.Start(ctx, "Cache.CreateUsers")
+	defer span.End()
+
+	results, err := c.repo.CreateMany(ctx, users, mode)
+	if err != nil {
+		return nil, err
+	}
+	c.applied(ctx, results, func(i int) { c.set(ctx, users[i]) })
+	return results, nil
+}
+
+// UpdateMany drops every user that was updated: their new versions are not
+// known here.
+func (c *Decorator) UpdateMany(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	ctx, span := tracing.Start(ctx, "Cache.UpdateUsers")
+	defer span.End()
+
+	results, err := c.repo.UpdateMany(ctx, users, mode)
+	if err != nil {
+		return nil, err
+	}
+	c.applied(ctx, results, func(i int) { c.users.Invalidate(ctx, users[i].ID) })
+	return results, nil
+}
+
+// DeleteMany drops every user that was deleted.
+func (c *Decorator) DeleteMany(ctx context.Context, ids []string, mode models.BulkMode) ([]models.BulkResult, error) {
+	ctx, span := tracing.Start(ctx, "Cache.DeleteUsers")
+	defer span.End()
+
+	results, err := c.repo.DeleteMany(ctx, ids, mode)
+	if err != nil {
+		return nil, err
+	}
+	c.applied(ctx, results, func(i int) { c.users.delete(ctx, ids[i]) })
+	return results, nil
+}
+
+// applied calls fn for every item that was written and bumps the page
+// generation if there was any.
+func (c *Decorator) applied(ctx context.Context, results []models.BulkResult, fn func(i int)) {
+	written := false
+	for i, res := range results {
+		if res.Err == nil {
+			fn(i)
+			written = true
+		}
+	}
+	if written {
+		c.bumpGeneration(ctx)
+	}
+}
+
+// Export is not cached: it reads the whole table from one snapshot.
+func (c *Decorator) Export(ctx context.Context, filter models.UserFilter, fn func(*models.User) error) error {
+	ctx, span := tracing.Start(ctx, "Cache.ExportUsers")
+	defer span.End()
+	return c.repo.Export(ctx, filter, fn)
+}
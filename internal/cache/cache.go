@@ -2,117 +2,140 @@ package cache
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
-	"sync"
 	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/sync/singleflight"
 
-	"app/internal/metrics"
+	"app/internal/apperr"
 	"app/internal/models"
 	"app/internal/repository"
 	"app/internal/tracing"
 )
 
+const userEntity = "user"
+
+// Decorator caches a repository.UserProvider. Single users are cached by an
+// Entity; list pages are cached here.
 type Decorator struct {
 	repo     repository.UserProvider
-	ttl      time.Duration
-	mu       sync.RWMutex
-	users    map[string]*cacheEntry
-	group    singleflight.Group
+	users    *Entity[string, *models.User]
+	store    Store
 	groupAll singleflight.Group
-}
 
-type cacheEntry struct {
-	user      *models.User
-	expiredAt time.Time
+	ttl          time.Duration
+	pageTTL      time.Duration
+	negTTL       time.Duration
+	refreshAhead time.Duration
+	staleGrace   time.Duration
+	loadTimeout  time.Duration
 }
 
-func NewDecorator(repo repository.UserProvider, ttl time.Duration) *Decorator {
-	return &Decorator{
-		repo:  repo,
-		ttl:   ttl,
-		users: make(map[string]*cacheEntry),
+type Option func(*Decorator)
+
+// WithStore replaces the default unbounded in-memory store.
+func WithStore(store Store) Option {
+	return func(c *Decorator) {
+		c.store = store
 	}
 }
 
-func (c *Decorator) set(user *models.User) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.users[user.ID] = &cacheEntry{
-		user:      user,
-		expiredAt: time.Now().Add(c.ttl),
+// WithNegativeTTL remembers not-found results for ttl. Zero disables it.
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(c *Decorator) {
+		c.negTTL = ttl
 	}
 }
 
-func (c *Decorator) get(id string) (*models.User, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	entry, ok := c.users[id]
-	if !ok || time.Now().After(entry.expiredAt) {
-		return nil, false
+// WithRefreshAhead reloads an entry in the background once it is read within
+// d of going stale, so hot users never expire under load. Zero disables it.
+func WithRefreshAhead(d time.Duration) Option {
+	return func(c *Decorator) {
+		c.refreshAhead = d
 	}
-	return entry.user, true
 }
 
-func (c *Decorator) Get(ctx context.Context, id string) (*models.User, error) {
-	ctx, span := tracing.Start(ctx, "Cache.GetUser")
-	defer span.End()
+// WithStaleGrace keeps serving an expired entry for up to d while one
+// background refresh replaces it. Entries are stored for ttl+d, so a stale
+// entry is dropped d after expiring even if every refresh fails. Zero
+// disables it.
+func WithStaleGrace(d time.Duration) Option {
+	return func(c *Decorator) {
+		c.staleGrace = d
+	}
+}
 
-	if user, ok := c.get(id); ok {
-		metrics.IncCacheHits()
-		slog.Debug("Cache hit", "userID", id)
-		return user, nil
+// WithLoadTimeout bounds a repository load shared by concurrent callers,
+// which runs detached from them. Zero keeps the default of 5s.
+func WithLoadTimeout(d time.Duration) Option {
+	return func(c *Decorator) {
+		c.loadTimeout = d
 	}
+}
 
-	metrics.IncCacheMisses()
-	slog.Debug("Cache miss - loading from repo", "userID", id)
+func NewDecorator(repo repository.UserProvider, ttl time.Duration, opts ...Option) *Decorator {
+	c := &Decorator{
+		repo: repo,
+		ttl:  ttl,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.store == nil {
+		c.store = NewMemoryStore(0, 0, PolicyLRU)
+	}
+	if c.loadTimeout <= 0 {
+		c.loadTimeout = defaultLoadTimeout
+	}
+	c.users = NewEntity[string, *models.User](repo, c.store, EntityConfig[string, *models.User]{
+		Name: userEntity,
+		Key:  func(u *models.User) string { return u.ID },
+		SetKey: func(u *models.User, id string) *models.User {
+			u.ID = id
+			return u
+		},
+		FormatKey:    func(id string) string { return id },
+		TTL:          ttl,
+		NegativeTTL:  c.negTTL,
+		RefreshAhead: c.refreshAhead,
+		StaleGrace:   c.staleGrace,
+		LoadTimeout:  c.loadTimeout,
+	})
+	return c
+}
 
-	result, err, _ := c.group.Do(id, func() (interface{}, error) {
-		if user, ok := c.get(id); ok {
-			slog.Debug("Cache hit (inside singleflight)", "userID", id)
-			metrics.IncCacheHits()
-			return user, nil
-		}
+func (c *Decorator) set(ctx context.Context, user *models.User) {
+	c.users.set(ctx, user)
+}
 
-		userFromRepo, err := c.repo.Get(ctx, id)
-		if err != nil {
-			return nil, err
-		}
-		c.set(userFromRepo)
-		slog.Debug("Loaded from repo (singleflight)", "userID", id)
-		return userFromRepo, nil
-	})
-	if err != nil {
-		return nil, err
-	}
+func (c *Decorator) get(ctx context.Context, id string) (*models.User, bool) {
+	return c.users.get(ctx, id)
+}
 
-	return result.(*models.User), nil
+func (c *Decorator) Get(ctx context.Context, id string) (*models.User, error) {
+	return c.users.Get(ctx, id)
 }
 
+// CleanupExpired removes expired entries from stores that do not expire
+// them on their own.
 func (c *Decorator) CleanupExpired() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	now := time.Now()
-	for id, entry := range c.users {
-		if now.After(entry.expiredAt) {
-			delete(c.users, id)
-			metrics.IncCacheExpired()
-			slog.Debug("Cache expired - user removed", "userID", id)
-		}
+	if s, ok := c.store.(interface{ CleanupExpired() }); ok {
+		s.CleanupExpired()
 	}
 }
 
-func (c *Decorator) GetAll(ctx context.Context, limit, offset int) ([]*models.User, error) {
+func (c *Decorator) GetAll(ctx context.Context, q models.UserQuery) ([]*models.User, error) {
 	ctx, span := tracing.Start(ctx, "Cache.GetAllUsers")
 	defer span.End()
 
-	key := fmt.Sprintf("getAll:%d:%d", limit, offset)
-	result, err, _ := c.groupAll.Do(key, func() (interface{}, error) {
-		return c.repo.GetAll(ctx, limit, offset)
+	if c.pageTTL > 0 {
+		return c.getAllCached(ctx, q)
+	}
+
+	key := "getAll:" + q.CacheKey()
+	result, err := c.shareAll(ctx, key, func(ctx context.Context) (any, error) {
+		return c.repo.GetAll(ctx, q)
 	})
 	if err != nil {
 		return nil, err
@@ -120,43 +143,133 @@ func (c *Decorator) GetAll(ctx context.Context, limit, offset int) ([]*models.Us
 	return result.([]*models.User), nil
 }
 
-func (c *Decorator) Create(ctx context.Context, user *models.User) (string, error) {
-	ctx, span := tracing.Start(ctx, "Cache.CreateUser")
+// Search is not cached: terms rarely repeat and ranking depends on the
+// whole table.
+func (c *Decorator) Search(ctx context.Context, term string, limit int) ([]*models.UserMatch, error) {
+	ctx, span := tracing.Start(ctx, "Cache.SearchUsers")
 	defer span.End()
+	return c.repo.Search(ctx, term, limit)
+}
 
-	id, err := c.repo.Create(ctx, user)
+func (c *Decorator) Create(ctx context.Context, user *models.User) (string, error) {
+	id, err := c.users.Create(ctx, user)
 	if err != nil {
 		return "", err
 	}
-	user.ID = id
-	c.set(user)
+	c.bumpGeneration(ctx)
 	return id, nil
 }
 
+// Update caches the user at its new version. A version mismatch suggests the
+// cached copy the caller's precondition came from is stale, so it is dropped.
 func (c *Decorator) Update(ctx context.Context, user *models.User) error {
-	ctx, span := tracing.Start(ctx, "Cache.UpdateUser")
+	if err := c.users.Update(ctx, user); err != nil {
+		if errors.Is(err, apperr.ErrPreconditionFailed) {
+			c.users.Invalidate(ctx, user.ID)
+		}
+		return err
+	}
+	c.bumpGeneration(ctx)
+	return nil
+}
+
+// Upsert caches the user as written, replacing any not-found marker left
+// for a client-chosen id, and drops the cached copy on a version mismatch
+// like Update.
+func (c *Decorator) Upsert(ctx context.Context, user *models.User) (bool, error) {
+	ctx, span := tracing.Start(ctx, "Cache.UpsertUser")
 	defer span.End()
 
-	if err := c.repo.Update(ctx, user); err != nil {
+	created, err := c.repo.Upsert(ctx, user)
+	if err != nil {
+		if errors.Is(err, apperr.ErrPreconditionFailed) {
+			c.users.Invalidate(ctx, user.ID)
+		}
+		return false, err
+	}
+	c.set(ctx, user)
+	c.bumpGeneration(ctx)
+	return created, nil
+}
+
+func (c *Decorator) Delete(ctx context.Context, id string) error {
+	if err := c.users.Delete(ctx, id); err != nil {
 		return err
 	}
-	c.set(user)
+	c.bumpGeneration(ctx)
 	return nil
 }
 
-func (c *Decorator) delete(id string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	delete(c.users, id)
+// Patch caches the patched user, or drops the cached copy on a version
+// mismatch like Update.
+func (c *Decorator) Patch(ctx context.Context, id string, patch models.UserPatch, version int64) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Cache.PatchUser")
+	defer span.End()
+
+	user, err := c.repo.Patch(ctx, id, patch, version)
+	if err != nil {
+		if errors.Is(err, apperr.ErrPreconditionFailed) {
+			c.users.Invalidate(ctx, id)
+		}
+		return nil, err
+	}
+	c.set(ctx, user)
+	if !patch.IsEmpty() {
+		c.bumpGeneration(ctx)
+	}
+	return user, nil
 }
 
-func (c *Decorator) Delete(ctx context.Context, id string) error {
+// DeleteIfVersion is Delete conditional on the stored version.
+func (c *Decorator) DeleteIfVersion(ctx context.Context, id string, version int64) error {
 	ctx, span := tracing.Start(ctx, "Cache.DeleteUser")
 	defer span.End()
 
-	if err := c.repo.Delete(ctx, id); err != nil {
+	err := c.repo.DeleteIfVersion(ctx, id, version)
+	if err != nil && !errors.Is(err, apperr.ErrPreconditionFailed) {
+		return err
+	}
+	c.users.Invalidate(ctx, id)
+	if err != nil {
+		return err
+	}
+	c.bumpGeneration(ctx)
+	return nil
+}
+
+// Restore caches the restored user in place of the not-found marker its
+// deletion may have left.
+func (c *Decorator) Restore(ctx context.Context, id string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Cache.RestoreUser")
+	defer span.End()
+
+	user, err := c.repo.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.set(ctx, user)
+	c.bumpGeneration(ctx)
+	return user, nil
+}
+
+// Invalidate drops the cached copies of users without touching the
+// repository, for changes made elsewhere. List pages are dropped once for
+// all of them.
+func (c *Decorator) Invalidate(ctx context.Context, ids ...string) {
+	for _, id := range ids {
+		c.users.Invalidate(ctx, id)
+	}
+	c.bumpGeneration(ctx)
+}
+
+// Flush drops every cached user and list page.
+func (c *Decorator) Flush(ctx context.Context) error {
+	if err := c.users.Flush(ctx); err != nil {
 		return err
 	}
-	c.delete(id)
+	if err := c.flushPages(ctx); err != nil {
+		return errors.Wrap(err, "flush user pages")
+	}
+	slog.Info("Cache flushed")
 	return nil
 }
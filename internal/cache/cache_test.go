@@ -4,23 +4,35 @@ import (
 	"context"
 	"errors"
 	"os"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"app/internal/apperr"
 	"app/internal/metrics"
 	"app/internal/models"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
+// spans records every span ended by the package under test.
+var spans = tracetest.NewSpanRecorder()
+
 func TestMain(m *testing.M) {
 	metrics.Register(context.Background(), "8089")
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
 	os.Exit(m.Run())
 }
 
+// firstPage is the listing query used by the GetAll tests.
+var firstPage = models.UserQuery{Limit: 10}
+
 type MockUserProvider struct {
 	mock.Mock
 }
@@ -35,6 +47,11 @@ func (m *MockUserProvider) Update(ctx context.Context, user *models.User) error
 	return args.Error(0)
 }
 
+func (m *MockUserProvider) Upsert(ctx context.Context, user *models.User) (bool, error) {
+	args := m.Called(ctx, user)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockUserProvider) Get(ctx context.Context, id string) (*models.User, error) {
 	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
@@ -48,8 +65,71 @@ func (m *MockUserProvider) Delete(ctx context.Context, id string) error {
 	return args.Error(0)
 }
 
-func (m *MockUserProvider) GetAll(ctx context.Context, limit, offset int) ([]*models.User, error) {
-	args := m.Called(ctx, limit, offset)
+func (m *MockUserProvider) DeleteIfVersion(ctx context.Context, id string, version int64) error {
+	args := m.Called(ctx, id, version)
+	return args.Error(0)
+}
+
+func (m *MockUserProvider) Restore(ctx context.Context, id string) (*models.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserProvider) Patch(ctx context.Context, id string, patch models.UserPatch, version int64) (*models.User, error) {
+	args := m.Called(ctx, id, patch, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserProvider) Count(ctx context.Context, filter models.UserFilter) (models.UserCount, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(models.UserCount), args.Error(1)
+}
+
+func (m *MockUserProvider) Search(ctx context.Context, term string, limit int) ([]*models.UserMatch, error) {
+	args := m.Called(ctx, term, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.UserMatch), args.Error(1)
+}
+
+func (m *MockUserProvider) CreateMany(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	args := m.Called(ctx, users, mode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.BulkResult), args.Error(1)
+}
+
+func (m *MockUserProvider) UpdateMany(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	args := m.Called(ctx, users, mode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.BulkResult), args.Error(1)
+}
+
+func (m *MockUserProvider) DeleteMany(ctx context.Context, ids []string, mode models.BulkMode) ([]models.BulkResult, error) {
+	args := m.Called(ctx, ids, mode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.BulkResult), args.Error(1)
+}
+
+func (m *MockUserProvider) Export(ctx context.Context, filter models.UserFilter, fn func(*models.User) error) error {
+	args := m.Called(ctx, filter, fn)
+	return args.Error(0)
+}
+
+func (m *MockUserProvider) GetAll(ctx context.Context, q models.UserQuery) ([]*models.User, error) {
+	args := m.Called(ctx, q)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -66,7 +146,7 @@ func TestDecorator_Get_CacheHit(t *testing.T) {
 		Age:  30,
 	}
 
-	cache.set(testUser)
+	cache.set(context.Background(), testUser)
 
 	user, err := cache.Get(context.Background(), "123")
 
@@ -93,7 +173,7 @@ func TestDecorator_Get_CacheMiss(t *testing.T) {
 	assert.Equal(t, testUser, user)
 	mockRepo.AssertExpectations(t)
 
-	cachedUser, ok := cache.get("123")
+	cachedUser, ok := cache.get(context.Background(), "123")
 	assert.True(t, ok)
 	assert.Equal(t, testUser, cachedUser)
 }
@@ -124,7 +204,7 @@ func TestDecorator_Get_ExpiredEntry(t *testing.T) {
 		Age:  30,
 	}
 
-	cache.set(testUser)
+	cache.set(context.Background(), testUser)
 	time.Sleep(2 * time.Nanosecond)
 
 	mockRepo.On("Get", mock.Anything, "123").Return(testUser, nil).Once()
@@ -153,7 +233,7 @@ func TestDecorator_Create(t *testing.T) {
 	assert.Equal(t, "123", id)
 	mockRepo.AssertExpectations(t)
 
-	cachedUser, ok := cache.get("123")
+	cachedUser, ok := cache.get(context.Background(), "123")
 	assert.True(t, ok)
 	assert.Equal(t, "123", cachedUser.ID)
 	assert.Equal(t, testUser.Name, cachedUser.Name)
@@ -177,7 +257,7 @@ func TestDecorator_Update(t *testing.T) {
 	require.NoError(t, err)
 	mockRepo.AssertExpectations(t)
 
-	cachedUser, ok := cache.get("123")
+	cachedUser, ok := cache.get(context.Background(), "123")
 	assert.True(t, ok)
 	assert.Equal(t, testUser, cachedUser)
 }
@@ -192,7 +272,7 @@ func TestDecorator_Delete(t *testing.T) {
 		Age:  30,
 	}
 
-	cache.set(testUser)
+	cache.set(context.Background(), testUser)
 
 	mockRepo.On("Delete", mock.Anything, "123").Return(nil).Once()
 
@@ -201,7 +281,7 @@ func TestDecorator_Delete(t *testing.T) {
 	require.NoError(t, err)
 	mockRepo.AssertExpectations(t)
 
-	_, ok := cache.get("123")
+	_, ok := cache.get(context.Background(), "123")
 	assert.False(t, ok)
 }
 
@@ -214,15 +294,15 @@ func TestDecorator_GetAll(t *testing.T) {
 		{ID: "2", Name: "User 2", Age: 35},
 	}
 
-	mockRepo.On("GetAll", mock.Anything, 10, 0).Return(testUsers, nil).Once()
+	mockRepo.On("GetAll", mock.Anything, firstPage).Return(testUsers, nil).Once()
 
-	users, err := cache.GetAll(context.Background(), 10, 0)
+	users, err := cache.GetAll(context.Background(), firstPage)
 
 	require.NoError(t, err)
 	assert.Equal(t, testUsers, users)
 	mockRepo.AssertExpectations(t)
 
-	_, ok := cache.get("1")
+	_, ok := cache.get(context.Background(), "1")
 	assert.False(t, ok)
 }
 
@@ -236,12 +316,12 @@ func TestDecorator_CleanupExpired(t *testing.T) {
 		Age:  30,
 	}
 
-	cache.set(testUser)
+	cache.set(context.Background(), testUser)
 	time.Sleep(2 * time.Nanosecond)
 
 	cache.CleanupExpired()
 
-	_, ok := cache.get("123")
+	_, ok := cache.get(context.Background(), "123")
 	assert.False(t, ok)
 }
 
@@ -289,3 +369,669 @@ func TestDecorator_ConcurrentAccess(t *testing.T) {
 
 	mockRepo.AssertNumberOfCalls(t, "Get", 1)
 }
+
+func TestDecorator_Invalidate(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute)
+
+	cache.set(context.Background(), &models.User{ID: "123", Name: "Test User", Age: 30})
+	cache.set(context.Background(), &models.User{ID: "456", Name: "Other User", Age: 31})
+	cache.set(context.Background(), &models.User{ID: "789", Name: "Third User", Age: 32})
+
+	cache.Invalidate(context.Background(), "123", "789")
+
+	_, ok := cache.get(context.Background(), "123")
+	assert.False(t, ok)
+	_, ok = cache.get(context.Background(), "789")
+	assert.False(t, ok)
+	_, ok = cache.get(context.Background(), "456")
+	assert.True(t, ok)
+	mockRepo.AssertNotCalled(t, "Delete")
+}
+
+func TestDecorator_Flush(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute)
+
+	cache.set(context.Background(), &models.User{ID: "123", Name: "Test User", Age: 30})
+	cache.set(context.Background(), &models.User{ID: "456", Name: "Other User", Age: 31})
+
+	require.NoError(t, cache.Flush(context.Background()))
+
+	_, ok := cache.get(context.Background(), "123")
+	assert.False(t, ok)
+	_, ok = cache.get(context.Background(), "456")
+	assert.False(t, ok)
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := jitter(time.Second)
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.Less(t, d, time.Second)
+	}
+}
+
+func TestDecorator_GetAll_PageCached(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithPageTTL(time.Minute))
+
+	testUsers := []*models.User{
+		{ID: "1", Name: "User 1", Age: 30},
+		{ID: "2", Name: "User 2", Age: 35},
+	}
+
+	mockRepo.On("GetAll", mock.Anything, firstPage).Return(testUsers, nil).Once()
+
+	for i := 0; i < 3; i++ {
+		users, err := cache.GetAll(context.Background(), firstPage)
+		require.NoError(t, err)
+		assert.Equal(t, testUsers, users)
+	}
+	mockRepo.AssertExpectations(t)
+
+	cachedUser, ok := cache.get(context.Background(), "1")
+	assert.True(t, ok)
+	assert.Equal(t, testUsers[0], cachedUser)
+}
+
+func TestDecorator_GetAll_WritesInvalidatePages(t *testing.T) {
+	ctx := context.Background()
+	testUsers := []*models.User{{ID: "1", Name: "User 1", Age: 30}}
+
+	writes := map[string]func(c *Decorator, m *MockUserProvider) error{
+		"create": func(c *Decorator, m *MockUserProvider) error {
+			user := &models.User{Name: "New", Age: 20}
+			m.On("Create", mock.Anything, user).Return("2", nil).Once()
+			_, err := c.Create(ctx, user)
+			return err
+		},
+		"update": func(c *Decorator, m *MockUserProvider) error {
+			user := &models.User{ID: "1", Name: "Renamed", Age: 30}
+			m.On("Update", mock.Anything, user).Return(nil).Once()
+			return c.Update(ctx, user)
+		},
+		"upsert": func(c *Decorator, m *MockUserProvider) error {
+			user := &models.User{ID: "2", Name: "Chosen", Age: 40}
+			m.On("Upsert", mock.Anything, user).Return(true, nil).Once()
+			_, err := c.Upsert(ctx, user)
+			return err
+		},
+		"delete": func(c *Decorator, m *MockUserProvider) error {
+			m.On("Delete", mock.Anything, "1").Return(nil).Once()
+			return c.Delete(ctx, "1")
+		},
+		"invalidate": func(c *Decorator, _ *MockUserProvider) error {
+			c.Invalidate(ctx, "1")
+			return nil
+		},
+		"delete many": func(c *Decorator, m *MockUserProvider) error {
+			ids := []string{"1"}
+			m.On("DeleteMany", mock.Anything, ids, models.BulkAtomic).Return([]models.BulkResult{{ID: "1"}}, nil).Once()
+			_, err := c.DeleteMany(ctx, ids, models.BulkAtomic)
+			return err
+		},
+	}
+
+	for name, write := range writes {
+		t.Run(name, func(t *testing.T) {
+			mockRepo := new(MockUserProvider)
+			cache := NewDecorator(mockRepo, 10*time.Minute, WithPageTTL(time.Minute))
+			mockRepo.On("GetAll", mock.Anything, firstPage).Return(testUsers, nil).Twice()
+
+			_, err := cache.GetAll(ctx, firstPage)
+			require.NoError(t, err)
+
+			require.NoError(t, write(cache, mockRepo))
+
+			_, err = cache.GetAll(ctx, firstPage)
+			require.NoError(t, err)
+			mockRepo.AssertNumberOfCalls(t, "GetAll", 2)
+		})
+	}
+}
+
+func TestDecorator_GetAll_ConcurrentWriteSkipsCaching(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithPageTTL(time.Minute))
+
+	stale := []*models.User{{ID: "1", Name: "Old Name", Age: 30}}
+	mockRepo.On("GetAll", mock.Anything, firstPage).Return(stale, nil).Once().Run(func(mock.Arguments) {
+		cache.bumpGeneration(ctx)
+	})
+
+	_, err := cache.GetAll(ctx, firstPage)
+	require.NoError(t, err)
+
+	_, ok := cache.get(ctx, "1")
+	assert.False(t, ok, "page loaded across a write must not populate the user cache")
+
+	mockRepo.On("GetAll", mock.Anything, firstPage).Return(stale, nil).Once()
+	_, err = cache.GetAll(ctx, firstPage)
+	require.NoError(t, err)
+	mockRepo.AssertNumberOfCalls(t, "GetAll", 2)
+}
+
+func TestDecorator_GetAll_KeepsNewerCachedUsers(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithPageTTL(time.Minute))
+
+	newer := &models.User{ID: "1", Name: "New Name", Age: 30}
+	cache.set(ctx, newer)
+	mockRepo.On("GetAll", mock.Anything, firstPage).
+		Return([]*models.User{{ID: "1", Name: "Old Name", Age: 30}, {ID: "2", Name: "User 2", Age: 35}}, nil).Once()
+
+	_, err := cache.GetAll(ctx, firstPage)
+	require.NoError(t, err)
+
+	cached, ok := cache.get(ctx, "1")
+	require.True(t, ok)
+	assert.Equal(t, newer, cached, "a page must not replace a user a write cached")
+	_, ok = cache.get(ctx, "2")
+	assert.True(t, ok)
+}
+
+func TestDecorator_GetAll_CallerCancelDoesNotFailWaiters(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithPageTTL(time.Minute))
+
+	testUsers := []*models.User{{ID: "1", Name: "User 1", Age: 30}}
+	started, release := make(chan struct{}), make(chan struct{})
+	var loadErr error
+	mockRepo.On("GetAll", mock.Anything, firstPage).Return(testUsers, nil).Once().Run(func(args mock.Arguments) {
+		close(started)
+		<-release
+		loadErr = args.Get(0).(context.Context).Err()
+	})
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := cache.GetAll(first, firstPage)
+		firstErr <- err
+	}()
+	<-started
+
+	type result struct {
+		users []*models.User
+		err   error
+	}
+	second := make(chan result, 1)
+	go func() {
+		users, err := cache.GetAll(context.Background(), firstPage)
+		second <- result{users, err}
+	}()
+
+	cancel()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+	close(release)
+
+	res := <-second
+	require.NoError(t, res.err)
+	assert.Equal(t, testUsers, res.users)
+	assert.NoError(t, loadErr, "the shared load must not inherit the first caller's cancellation")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDecorator_Get_NegativeCache(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithNegativeTTL(time.Minute))
+
+	mockRepo.On("Get", mock.Anything, "404").Return(nil, apperr.ErrNotFound).Once()
+
+	for i := 0; i < 3; i++ {
+		user, err := cache.Get(context.Background(), "404")
+		require.ErrorIs(t, err, apperr.ErrNotFound)
+		assert.Nil(t, user)
+	}
+	mockRepo.AssertNumberOfCalls(t, "Get", 1)
+
+	_, ok := cache.get(context.Background(), "404")
+	assert.False(t, ok)
+}
+
+func TestDecorator_Get_NegativeCacheDisabled(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute)
+
+	mockRepo.On("Get", mock.Anything, "404").Return(nil, apperr.ErrNotFound).Twice()
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.Get(context.Background(), "404")
+		require.ErrorIs(t, err, apperr.ErrNotFound)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDecorator_Get_NegativeCacheExpires(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithNegativeTTL(time.Nanosecond))
+
+	mockRepo.On("Get", mock.Anything, "404").Return(nil, apperr.ErrNotFound).Twice()
+
+	_, err := cache.Get(context.Background(), "404")
+	require.ErrorIs(t, err, apperr.ErrNotFound)
+	time.Sleep(2 * time.Nanosecond)
+	_, err = cache.Get(context.Background(), "404")
+	require.ErrorIs(t, err, apperr.ErrNotFound)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDecorator_Create_ClearsNegativeEntry(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithNegativeTTL(time.Minute))
+
+	mockRepo.On("Get", mock.Anything, "123").Return(nil, apperr.ErrNotFound).Once()
+	_, err := cache.Get(context.Background(), "123")
+	require.ErrorIs(t, err, apperr.ErrNotFound)
+
+	testUser := &models.User{Name: "Test User", Age: 30}
+	mockRepo.On("Create", mock.Anything, testUser).Return("123", nil).Once()
+	_, err = cache.Create(context.Background(), testUser)
+	require.NoError(t, err)
+
+	user, err := cache.Get(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, "Test User", user.Name)
+	mockRepo.AssertNumberOfCalls(t, "Get", 1)
+}
+
+func TestDecorator_Get_StaleWhileRevalidate(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Millisecond, WithStaleGrace(time.Minute))
+
+	oldUser := &models.User{ID: "123", Name: "Old Name", Age: 30}
+	newUser := &models.User{ID: "123", Name: "New Name", Age: 30}
+	cache.set(context.Background(), oldUser)
+	time.Sleep(2 * time.Millisecond)
+
+	refreshed := make(chan struct{})
+	mockRepo.On("Get", mock.Anything, "123").Return(newUser, nil).Once().Run(func(mock.Arguments) {
+		close(refreshed)
+	})
+
+	user, err := cache.Get(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, oldUser, user, "stale value is served while refreshing")
+
+	<-refreshed
+	require.Eventually(t, func() bool {
+		entry, ok := cache.users.lookup(context.Background(), "123")
+		return ok && entry.Value.Name == "New Name"
+	}, time.Second, time.Millisecond)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDecorator_Get_StaleServedWhileRepoDown(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Millisecond, WithStaleGrace(time.Minute))
+
+	oldUser := &models.User{ID: "123", Name: "Old Name", Age: 30}
+	cache.set(context.Background(), oldUser)
+	time.Sleep(2 * time.Millisecond)
+
+	mockRepo.On("Get", mock.Anything, "123").Return(nil, errors.New("connection refused"))
+
+	for i := 0; i < 3; i++ {
+		user, err := cache.Get(context.Background(), "123")
+		require.NoError(t, err)
+		assert.Equal(t, oldUser, user)
+		require.Eventually(t, func() bool {
+			_, busy := cache.users.refreshing.Load(cache.users.storeKey("123"))
+			return !busy
+		}, time.Second, time.Millisecond)
+	}
+}
+
+func TestDecorator_Get_RefreshAhead(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Minute, WithRefreshAhead(2*time.Minute))
+
+	testUser := &models.User{ID: "123", Name: "Test User", Age: 30}
+	cache.set(context.Background(), testUser)
+
+	refreshed := make(chan struct{})
+	mockRepo.On("Get", mock.Anything, "123").Return(testUser, nil).Once().Run(func(mock.Arguments) {
+		close(refreshed)
+	})
+
+	user, err := cache.Get(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, testUser, user)
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("entry close to expiry was not refreshed ahead")
+	}
+}
+
+func TestDecorator_Get_RefreshSurvivesCallerCancel(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Millisecond, WithStaleGrace(time.Minute))
+
+	testUser := &models.User{ID: "123", Name: "Test User", Age: 30}
+	cache.set(context.Background(), testUser)
+	time.Sleep(2 * time.Millisecond)
+
+	refreshErr := make(chan error, 1)
+	mockRepo.On("Get", mock.Anything, "123").Return(testUser, nil).Once().Run(func(args mock.Arguments) {
+		refreshErr <- args.Get(0).(context.Context).Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := cache.Get(ctx, "123")
+	require.NoError(t, err)
+	cancel()
+
+	select {
+	case err := <-refreshErr:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("background refresh did not run")
+	}
+}
+
+func TestDecorator_Get_LoadTimeout(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Minute, WithLoadTimeout(20*time.Millisecond))
+
+	mockRepo.On("Get", mock.Anything, "123").Return(nil, context.DeadlineExceeded).Once().Run(func(args mock.Arguments) {
+		<-args.Get(0).(context.Context).Done()
+	})
+
+	start := time.Now()
+	_, err := cache.Get(context.Background(), "123")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), defaultLoadTimeout, "the configured timeout replaces the default")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDecorator_Get_LoadSurvivesFirstCallerCancel(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Minute)
+
+	testUser := &models.User{ID: "123", Name: "Test User", Age: 30}
+	release := make(chan struct{})
+	loadErr := make(chan error, 1)
+	mockRepo.On("Get", mock.Anything, "123").Return(testUser, nil).Once().Run(func(args mock.Arguments) {
+		<-release
+		loadErr <- args.Get(0).(context.Context).Err()
+	})
+
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := cache.Get(first, "123")
+		firstErr <- err
+	}()
+	waitForWaiters(t, cache.users, "123", 1)
+
+	second := make(chan *models.User, 1)
+	go func() {
+		user, err := cache.Get(context.Background(), "123")
+		assert.NoError(t, err)
+		second <- user
+	}()
+	waitForWaiters(t, cache.users, "123", 2)
+
+	cancel()
+	select {
+	case err := <-firstErr:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("cancelled caller kept waiting for the load")
+	}
+
+	close(release)
+	select {
+	case user := <-second:
+		assert.Equal(t, testUser, user)
+	case <-time.After(time.Second):
+		t.Fatal("second caller did not get the loaded user")
+	}
+	assert.NoError(t, <-loadErr, "load must not inherit the first caller's cancellation")
+	mockRepo.AssertExpectations(t)
+
+	cached, ok := cache.get(context.Background(), "123")
+	assert.True(t, ok)
+	assert.Equal(t, testUser, cached)
+}
+
+// benchmarkParallelGetSet drives a cached user set with nine reads to every
+// write from all Ps, while another goroutine keeps sweeping expired entries.
+func benchmarkParallelGetSet(b *testing.B, store *MemoryStore) {
+	const users = 10_000
+
+	ctx := context.Background()
+	cache := NewDecorator(new(MockUserProvider), time.Minute, WithStore(store))
+	ids := make([]string, users)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+		cache.set(ctx, &models.User{ID: ids[i], Name: "User " + ids[i], Age: i % 100})
+	}
+	for i := 0; i < users; i++ {
+		_ = store.Set(ctx, "expiring:"+strconv.Itoa(i), []byte("v"), time.Nanosecond)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				store.CleanupExpired()
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			id := ids[i%users]
+			if i%10 == 0 {
+				cache.set(ctx, &models.User{ID: id, Name: "User " + id})
+			} else {
+				cache.get(ctx, id)
+			}
+			i++
+		}
+	})
+	b.StopTimer()
+
+	close(stop)
+	<-done
+}
+
+func BenchmarkDecorator_ParallelGetSet(b *testing.B) {
+	for _, shards := range []int{1, 4, defaultShards, 64} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			benchmarkParallelGetSet(b, NewShardedMemoryStore(shards, 0, 0, PolicyLRU))
+		})
+	}
+}
+
+func BenchmarkDecorator_ParallelGetSet_Bounded(b *testing.B) {
+	for _, shards := range []int{1, defaultShards} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			benchmarkParallelGetSet(b, NewShardedMemoryStore(shards, 50_000, 0, PolicyTinyLFU))
+		})
+	}
+}
+
+func TestDecorator_GetAll_PagesKeyedOnQuery(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Minute, WithPageTTL(time.Minute))
+	ctx := context.Background()
+
+	byAge := models.UserQuery{Limit: 10, Sort: []models.SortField{{Field: "age", Desc: true}}}
+	next := models.UserQuery{Limit: 10, After: &models.UserCursor{Sort: "id", ID: "1"}}
+	mockRepo.On("GetAll", mock.Anything, firstPage).Return([]*models.User{{ID: "1"}}, nil).Once()
+	mockRepo.On("GetAll", mock.Anything, byAge).Return([]*models.User{{ID: "2"}}, nil).Once()
+	mockRepo.On("GetAll", mock.Anything, next).Return([]*models.User{{ID: "3"}}, nil).Once()
+
+	for i := 0; i < 2; i++ {
+		for q, want := range map[*models.UserQuery]string{&firstPage: "1", &byAge: "2", &next: "3"} {
+			users, err := cache.GetAll(ctx, *q)
+			require.NoError(t, err)
+			require.Len(t, users, 1)
+			assert.Equal(t, want, users[0].ID)
+		}
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDecorator_Count_CachedUntilWrite(t *testing.T) {
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Minute, WithPageTTL(time.Minute))
+	ctx := context.Background()
+
+	minAge := 18
+	adults := models.UserFilter{AgeMin: &minAge}
+	mockRepo.On("Count", mock.Anything, models.UserFilter{}).Return(models.UserCount{Total: 3}, nil).Twice()
+	mockRepo.On("Count", mock.Anything, adults).Return(models.UserCount{Total: 2}, nil).Once()
+
+	for i := 0; i < 2; i++ {
+		count, err := cache.Count(ctx, models.UserFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), count.Total)
+		count, err = cache.Count(ctx, adults)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count.Total)
+	}
+
+	cache.Invalidate(ctx, "1")
+	_, err := cache.Count(ctx, models.UserFilter{})
+	require.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDecorator_UpdateMany_DropsApplied(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute)
+
+	cached := []*models.User{
+		{ID: "1", Name: "Old One", Age: 10, Version: 1},
+		{ID: "2", Name: "Old Two", Age: 20, Version: 1},
+	}
+	for _, user := range cached {
+		cache.set(ctx, user)
+	}
+
+	users := []*models.User{
+		{ID: "1", Name: "One", Age: 10},
+		{ID: "2", Name: "Two", Age: 20},
+	}
+	results := []models.BulkResult{{ID: "1"}, {ID: "2", Err: apperr.ErrNotFound}}
+	mockRepo.On("UpdateMany", mock.Anything, users, models.BulkBestEffort).Return(results, nil).Once()
+
+	got, err := cache.UpdateMany(ctx, users, models.BulkBestEffort)
+	require.NoError(t, err)
+	assert.Equal(t, results, got)
+
+	_, ok := cache.get(ctx, "1")
+	assert.False(t, ok, "an updated user must be reloaded to learn its version")
+	user, ok := cache.get(ctx, "2")
+	require.True(t, ok)
+	assert.Equal(t, cached[1], user, "a failed item keeps its cache entry")
+}
+
+func TestDecorator_Update_VersionMismatchDropsEntry(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute)
+
+	cache.set(ctx, &models.User{ID: "1", Name: "Ann", Age: 30, Version: 3})
+	user := &models.User{ID: "1", Name: "Ann", Age: 31, Version: 3}
+	mockRepo.On("Update", mock.Anything, user).Return(apperr.ErrPreconditionFailed).Once()
+
+	err := cache.Update(ctx, user)
+	assert.ErrorIs(t, err, apperr.ErrPreconditionFailed)
+	_, ok := cache.get(ctx, "1")
+	assert.False(t, ok)
+}
+
+func TestDecorator_DeleteIfVersion(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute)
+
+	cache.set(ctx, &models.User{ID: "1", Name: "Ann", Age: 30, Version: 2})
+	mockRepo.On("DeleteIfVersion", mock.Anything, "1", int64(2)).Return(nil).Once()
+
+	require.NoError(t, cache.DeleteIfVersion(ctx, "1", 2))
+	_, ok := cache.get(ctx, "1")
+	assert.False(t, ok)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDecorator_Upsert_ClearsNegativeEntry(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithNegativeTTL(time.Minute))
+
+	mockRepo.On("Get", mock.Anything, "1").Return(nil, apperr.ErrNotFound).Once()
+	_, err := cache.Get(ctx, "1")
+	require.ErrorIs(t, err, apperr.ErrNotFound)
+
+	user := &models.User{ID: "1", Name: "Ann", Age: 30}
+	mockRepo.On("Upsert", mock.Anything, user).Run(func(args mock.Arguments) {
+		args.Get(1).(*models.User).Version = 1
+	}).Return(true, nil).Once()
+	created, err := cache.Upsert(ctx, user)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	cachedUser, err := cache.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, &models.User{ID: "1", Name: "Ann", Age: 30, Version: 1}, cachedUser)
+	mockRepo.AssertNumberOfCalls(t, "Get", 1)
+}
+
+func TestDecorator_Restore_ClearsNegativeEntry(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithNegativeTTL(time.Minute))
+
+	mockRepo.On("Get", mock.Anything, "1").Return(nil, apperr.ErrNotFound).Once()
+	_, err := cache.Get(ctx, "1")
+	require.ErrorIs(t, err, apperr.ErrNotFound)
+
+	restored := &models.User{ID: "1", Name: "Ann", Age: 30, Version: 3}
+	mockRepo.On("Restore", mock.Anything, "1").Return(restored, nil).Once()
+	_, err = cache.Restore(ctx, "1")
+	require.NoError(t, err)
+
+	user, err := cache.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, restored, user)
+	mockRepo.AssertNumberOfCalls(t, "Get", 1)
+}
+
+func TestDecorator_GetAll_DeletedUsersNotCachedByID(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithPageTTL(time.Minute))
+
+	deletedAt := time.Now()
+	q := models.UserQuery{Limit: 10, Filter: models.UserFilter{IncludeDeleted: true}}
+	mockRepo.On("GetAll", mock.Anything, q).Return([]*models.User{
+		{ID: "1", Name: "Ann", Age: 30},
+		{ID: "2", Name: "Bob", Age: 40, DeletedAt: &deletedAt},
+	}, nil).Once()
+
+	_, err := cache.GetAll(ctx, q)
+	require.NoError(t, err)
+	_, ok := cache.get(ctx, "1")
+	assert.True(t, ok)
+	_, ok = cache.get(ctx, "2")
+	assert.False(t, ok)
+}
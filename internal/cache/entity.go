@@ -0,0 +1,410 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"app/internal/apperr"
+	"app/internal/metrics"
+	"app/internal/tracing"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultLoadTimeout is the EntityConfig.LoadTimeout used when none is set.
+const defaultLoadTimeout = 5 * time.Second
+
+// Repository is the part of an entity repository that Entity caches.
+type Repository[K comparable, V any] interface {
+	Get(ctx context.Context, key K) (V, error)
+	Create(ctx context.Context, value V) (K, error)
+	Update(ctx context.Context, value V) error
+	Delete(ctx context.Context, key K) error
+}
+
+// EntityConfig describes how Entity caches one kind of value.
+type EntityConfig[K comparable, V any] struct {
+	// Name prefixes store keys, labels metrics and names spans, e.g. "user"
+	// gives keys "user:<key>" and spans "Cache.GetUser".
+	Name string
+	// Key extracts the key of a value.
+	Key func(V) K
+	// SetKey returns value with the key assigned by Create filled in.
+	// Optional; without it the value is cached as passed to Create.
+	SetKey func(value V, key K) V
+	// FormatKey renders a key for the store. Defaults to fmt.Sprint.
+	FormatKey func(K) string
+
+	TTL          time.Duration
+	NegativeTTL  time.Duration
+	RefreshAhead time.Duration
+	StaleGrace   time.Duration
+	// LoadTimeout bounds a shared load, which runs detached from the callers
+	// waiting on it and so has no deadline to inherit. Defaults to
+	// defaultLoadTimeout.
+	LoadTimeout time.Duration
+}
+
+// Entity is a read-through, write-through cache in front of a Repository.
+// It coalesces concurrent loads, can remember not-found results, refreshes
+// entries ahead of expiry and serves stale values while a refresh runs.
+type Entity[K comparable, V any] struct {
+	repo   Repository[K, V]
+	store  Store
+	cfg    EntityConfig[K, V]
+	prefix string
+	span   string
+
+	group      singleflight.Group
+	flights    sync.Map
+	refreshing sync.Map
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// entityEntry is what is stored under an entity key.
+type entityEntry[V any] struct {
+	Value     V         `json:"value"`
+	NotFound  bool      `json:"not_found,omitempty"`
+	StoredAt  time.Time `json:"stored_at"`
+	FreshTill time.Time `json:"fresh_till"`
+}
+
+func (e *entityEntry[V]) fresh(now time.Time) bool {
+	return now.Before(e.FreshTill)
+}
+
+func NewEntity[K comparable, V any](repo Repository[K, V], store Store, cfg EntityConfig[K, V]) *Entity[K, V] {
+	if cfg.Name == "" {
+		panic("cache: entity name is required")
+	}
+	if cfg.FormatKey == nil {
+		cfg.FormatKey = func(k K) string { return fmt.Sprint(k) }
+	}
+	if cfg.LoadTimeout <= 0 {
+		cfg.LoadTimeout = defaultLoadTimeout
+	}
+	return &Entity[K, V]{
+		repo:   repo,
+		store:  store,
+		cfg:    cfg,
+		prefix: cfg.Name + ":",
+		span:   strings.ToUpper(cfg.Name[:1]) + cfg.Name[1:],
+	}
+}
+
+func (e *Entity[K, V]) storeKey(key K) string {
+	return e.prefix + e.cfg.FormatKey(key)
+}
+
+func (e *Entity[K, V]) set(ctx context.Context, value V) {
+	e.put(ctx, e.cfg.Key(value), &entityEntry[V]{Value: value}, e.cfg.TTL, e.cfg.StaleGrace)
+}
+
+// add is set for a value that must not replace a cached one, such as a row
+// read along with others: a write may have cached a newer copy since. It
+// reports whether value was stored.
+func (e *Entity[K, V]) add(ctx context.Context, value V) bool {
+	key := e.cfg.Key(value)
+	data, ok := e.encode(key, &entityEntry[V]{Value: value}, e.cfg.TTL)
+	if !ok {
+		return false
+	}
+	added, err := e.store.Add(ctx, e.storeKey(key), data, e.cfg.TTL+e.cfg.StaleGrace)
+	if err != nil {
+		slog.Warn("Cache: failed to store entry", "entity", e.cfg.Name, "key", key, "error", err)
+	}
+	return added
+}
+
+func (e *Entity[K, V]) setNotFound(ctx context.Context, key K) {
+	e.put(ctx, key, &entityEntry[V]{NotFound: true}, e.cfg.NegativeTTL, 0)
+}
+
+// put stores entry as fresh for ttl and kept around as stale for grace more.
+func (e *Entity[K, V]) put(ctx context.Context, key K, entry *entityEntry[V], ttl, grace time.Duration) {
+	data, ok := e.encode(key, entry, ttl)
+	if !ok {
+		return
+	}
+	if err := e.store.Set(ctx, e.storeKey(key), data, ttl+grace); err != nil {
+		slog.Warn("Cache: failed to store entry", "entity", e.cfg.Name, "key", key, "error", err)
+	}
+}
+
+// encode stamps entry as stored now and fresh for ttl and encodes it.
+func (e *Entity[K, V]) encode(key K, entry *entityEntry[V], ttl time.Duration) ([]byte, bool) {
+	now := time.Now()
+	entry.StoredAt = now
+	entry.FreshTill = now.Add(ttl)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("Cache: failed to encode entry", "entity", e.cfg.Name, "key", key, "error", err)
+		return nil, false
+	}
+	return data, true
+}
+
+// get returns a fresh cached value.
+func (e *Entity[K, V]) get(ctx context.Context, key K) (V, bool) {
+	entry, ok := e.lookup(ctx, key)
+	if !ok || entry.NotFound || !entry.fresh(time.Now()) {
+		var zero V
+		return zero, false
+	}
+	return entry.Value, true
+}
+
+// lookup reads a cache entry, fresh or stale.
+func (e *Entity[K, V]) lookup(ctx context.Context, key K) (*entityEntry[V], bool) {
+	data, ok, err := e.store.Get(ctx, e.storeKey(key))
+	if err != nil {
+		slog.Warn("Cache: failed to read entry", "entity", e.cfg.Name, "key", key, "error", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+
+	var entry entityEntry[V]
+	if err := json.Unmarshal(data, &entry); err != nil {
+		slog.Warn("Cache: failed to decode entry", "entity", e.cfg.Name, "key", key, "error", err)
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (e *Entity[K, V]) delete(ctx context.Context, key K) {
+	if err := e.store.Delete(ctx, e.storeKey(key)); err != nil {
+		slog.Error("Cache: failed to invalidate entry", "entity", e.cfg.Name, "key", key, "error", err)
+	}
+}
+
+func (e *Entity[K, V]) Get(ctx context.Context, key K) (V, error) {
+	ctx, span := tracing.Start(ctx, "Cache.Get"+e.span)
+	defer span.End()
+
+	var zero V
+	if entry, ok := e.lookup(ctx, key); ok {
+		now := time.Now()
+		if !entry.fresh(now) {
+			metrics.IncCacheStaleServed(e.cfg.Name)
+			slog.Debug("Cache hit (stale) - refreshing in background", "entity", e.cfg.Name, "key", key)
+			e.refreshAsync(ctx, key)
+		} else if e.cfg.RefreshAhead > 0 && entry.FreshTill.Sub(now) < e.cfg.RefreshAhead {
+			slog.Debug("Cache hit (expiring) - refreshing ahead", "entity", e.cfg.Name, "key", key)
+			e.refreshAsync(ctx, key)
+		}
+		return e.serve(key, entry)
+	}
+
+	e.misses.Add(1)
+	metrics.IncCacheMisses(e.cfg.Name)
+	slog.Debug("Cache miss - loading from repo", "entity", e.cfg.Name, "key", key)
+
+	loaded := e.share(ctx, key, func(ctx context.Context) (V, error) {
+		if entry, ok := e.lookup(ctx, key); ok && entry.fresh(time.Now()) {
+			slog.Debug("Cache hit (inside singleflight)", "entity", e.cfg.Name, "key", key)
+			return e.serve(key, entry)
+		}
+
+		value, err := e.load(ctx, key)
+		if err != nil {
+			return value, err
+		}
+		slog.Debug("Loaded from repo (singleflight)", "entity", e.cfg.Name, "key", key)
+		return value, nil
+	})
+
+	select {
+	case res := <-loaded:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(V), nil
+	case <-ctx.Done():
+		slog.Debug("Cache: caller stopped waiting for load", "entity", e.cfg.Name, "key", key)
+		return zero, errors.Wrapf(ctx.Err(), "wait for %s %v", e.cfg.Name, key)
+	}
+}
+
+// flight is a load shared by every caller that missed on the same key. Its
+// span is a root linked to each waiter's span rather than a child of the
+// caller that happened to start it.
+type flight struct {
+	mu      sync.Mutex
+	span    trace.Span
+	links   []trace.Link
+	waiters int
+}
+
+func (f *flight) join(ctx context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.waiters++
+	link := trace.LinkFromContext(ctx)
+	if !link.SpanContext.IsValid() {
+		return
+	}
+	if f.span != nil {
+		f.span.AddLink(link)
+		return
+	}
+	f.links = append(f.links, link)
+}
+
+func (f *flight) start(ctx context.Context, name string) context.Context {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ctx, f.span = tracing.StartLinked(ctx, name, f.links...)
+	return ctx
+}
+
+func (f *flight) end() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.span.SetAttributes(attribute.Int("cache.waiters", f.waiters))
+	f.span.End()
+}
+
+// share runs fn once for all concurrent callers of key. fn gets a context
+// detached from every caller and bounded by LoadTimeout, so one caller going
+// away does not fail the load for the rest.
+func (e *Entity[K, V]) share(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) <-chan singleflight.Result {
+	storeKey := e.storeKey(key)
+	v, _ := e.flights.LoadOrStore(storeKey, new(flight))
+	f := v.(*flight)
+	f.join(ctx)
+
+	return e.group.DoChan(storeKey, func() (interface{}, error) {
+		defer e.flights.CompareAndDelete(storeKey, f)
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), e.cfg.LoadTimeout)
+		defer cancel()
+		ctx = f.start(ctx, "Cache.Load"+e.span)
+		defer f.end()
+
+		return fn(ctx)
+	})
+}
+
+// serve turns a cache entry into Get's result and counts the hit.
+func (e *Entity[K, V]) serve(key K, entry *entityEntry[V]) (V, error) {
+	e.hits.Add(1)
+	if entry.NotFound {
+		metrics.IncCacheNegativeHits(e.cfg.Name)
+		slog.Debug("Cache hit (not found)", "entity", e.cfg.Name, "key", key)
+		var zero V
+		return zero, errors.Wrapf(apperr.ErrNotFound, "cached: %s %v", e.cfg.Name, key)
+	}
+	metrics.IncCacheHits(e.cfg.Name)
+	slog.Debug("Cache hit", "entity", e.cfg.Name, "key", key)
+	return entry.Value, nil
+}
+
+// load reads a value from the repository and caches the outcome.
+func (e *Entity[K, V]) load(ctx context.Context, key K) (V, error) {
+	value, err := e.repo.Get(ctx, key)
+	if err != nil {
+		if e.cfg.NegativeTTL > 0 && errors.Is(err, apperr.ErrNotFound) {
+			metrics.IncCacheNegativeMisses(e.cfg.Name)
+			e.setNotFound(ctx, key)
+		}
+		return value, err
+	}
+	e.set(ctx, value)
+	return value, nil
+}
+
+// refreshAsync reloads key in the background unless a refresh is already
+// running. If the repository is unavailable the current entry is left in
+// place, so a stale value keeps being served until its grace runs out.
+func (e *Entity[K, V]) refreshAsync(ctx context.Context, key K) {
+	storeKey := e.storeKey(key)
+	if _, busy := e.refreshing.LoadOrStore(storeKey, struct{}{}); busy {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer e.refreshing.Delete(storeKey)
+
+		ctx, span := tracing.Start(ctx, "Cache.Refresh"+e.span)
+		defer span.End()
+
+		res := <-e.share(ctx, key, func(ctx context.Context) (V, error) {
+			return e.load(ctx, key)
+		})
+		if err := res.Err; err != nil && !errors.Is(err, apperr.ErrNotFound) {
+			metrics.IncCacheRefreshFailures(e.cfg.Name)
+			slog.Warn("Cache: background refresh failed, keeping stale entry", "entity", e.cfg.Name, "key", key, "error", err)
+		}
+	}()
+}
+
+func (e *Entity[K, V]) Create(ctx context.Context, value V) (K, error) {
+	ctx, span := tracing.Start(ctx, "Cache.Create"+e.span)
+	defer span.End()
+
+	key, err := e.repo.Create(ctx, value)
+	if err != nil {
+		return key, err
+	}
+	if e.cfg.SetKey != nil {
+		value = e.cfg.SetKey(value, key)
+	}
+	// Overwrites any not-found marker left for this key.
+	e.put(ctx, key, &entityEntry[V]{Value: value}, e.cfg.TTL, e.cfg.StaleGrace)
+	return key, nil
+}
+
+func (e *Entity[K, V]) Update(ctx context.Context, value V) error {
+	ctx, span := tracing.Start(ctx, "Cache.Update"+e.span)
+	defer span.End()
+
+	if err := e.repo.Update(ctx, value); err != nil {
+		return err
+	}
+	e.set(ctx, value)
+	return nil
+}
+
+func (e *Entity[K, V]) Delete(ctx context.Context, key K) error {
+	ctx, span := tracing.Start(ctx, "Cache.Delete"+e.span)
+	defer span.End()
+
+	if err := e.repo.Delete(ctx, key); err != nil {
+		return err
+	}
+	e.delete(ctx, key)
+	return nil
+}
+
+// Invalidate drops the cached copy of key without touching the repository,
+// for changes made elsewhere.
+func (e *Entity[K, V]) Invalidate(ctx context.Context, key K) {
+	e.delete(ctx, key)
+	slog.Debug("Cache invalidated", "entity", e.cfg.Name, "key", key)
+}
+
+// Flush drops every cached value of this entity.
+func (e *Entity[K, V]) Flush(ctx context.Context) error {
+	if err := e.store.DeletePrefix(ctx, e.prefix); err != nil {
+		return errors.Wrapf(err, "flush %s cache", e.cfg.Name)
+	}
+	return nil
+}
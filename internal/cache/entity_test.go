@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"app/internal/apperr"
+	"app/internal/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type testOrder struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type fakeOrderRepo struct {
+	mu     sync.Mutex
+	orders map[int]testOrder
+	nextID int
+	gets   int
+}
+
+func newFakeOrderRepo() *fakeOrderRepo {
+	return &fakeOrderRepo{orders: make(map[int]testOrder), nextID: 1}
+}
+
+func (r *fakeOrderRepo) Get(_ context.Context, id int) (testOrder, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gets++
+	o, ok := r.orders[id]
+	if !ok {
+		return testOrder{}, apperr.ErrNotFound
+	}
+	return o, nil
+}
+
+func (r *fakeOrderRepo) Create(_ context.Context, o testOrder) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.nextID
+	r.nextID++
+	o.ID = id
+	r.orders[id] = o
+	return id, nil
+}
+
+func (r *fakeOrderRepo) Update(_ context.Context, o testOrder) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.orders[o.ID]; !ok {
+		return apperr.ErrNotFound
+	}
+	r.orders[o.ID] = o
+	return nil
+}
+
+func (r *fakeOrderRepo) Delete(_ context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.orders[id]; !ok {
+		return apperr.ErrNotFound
+	}
+	delete(r.orders, id)
+	return nil
+}
+
+// blockingOrderRepo holds every Get until release is closed.
+type blockingOrderRepo struct {
+	*fakeOrderRepo
+	release chan struct{}
+}
+
+func (r *blockingOrderRepo) Get(ctx context.Context, id int) (testOrder, error) {
+	<-r.release
+	return r.fakeOrderRepo.Get(ctx, id)
+}
+
+// waitForWaiters blocks until n callers wait on the shared load of key.
+func waitForWaiters[K comparable, V any](t *testing.T, e *Entity[K, V], key K, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		v, ok := e.flights.Load(e.storeKey(key))
+		if !ok {
+			return false
+		}
+		f := v.(*flight)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.waiters >= n
+	}, time.Second, time.Millisecond)
+}
+
+func newOrderEntity(repo *fakeOrderRepo, store Store) *Entity[int, testOrder] {
+	return NewEntity[int, testOrder](repo, store, EntityConfig[int, testOrder]{
+		Name: "order",
+		Key:  func(o testOrder) int { return o.ID },
+		SetKey: func(o testOrder, id int) testOrder {
+			o.ID = id
+			return o
+		},
+		FormatKey:   strconv.Itoa,
+		TTL:         time.Minute,
+		NegativeTTL: time.Minute,
+	})
+}
+
+func TestEntity_ValueType(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeOrderRepo()
+	orders := newOrderEntity(repo, NewMemoryStore(0, 0, PolicyLRU))
+
+	id, err := orders.Create(ctx, testOrder{Title: "first"})
+	require.NoError(t, err)
+
+	o, err := orders.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, testOrder{ID: id, Title: "first"}, o)
+	assert.Zero(t, repo.gets, "create should populate the cache")
+
+	require.NoError(t, orders.Update(ctx, testOrder{ID: id, Title: "renamed"}))
+	o, err = orders.Get(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", o.Title)
+
+	require.NoError(t, orders.Delete(ctx, id))
+	_, err = orders.Get(ctx, id)
+	require.ErrorIs(t, err, apperr.ErrNotFound)
+	_, err = orders.Get(ctx, id)
+	require.ErrorIs(t, err, apperr.ErrNotFound)
+	assert.Equal(t, 1, repo.gets, "not-found result should be cached")
+}
+
+func TestEntity_SharesStoreWithoutCollisions(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(0, 0, PolicyLRU)
+	repo := newFakeOrderRepo()
+	orders := newOrderEntity(repo, store)
+	users := NewDecorator(new(MockUserProvider), time.Minute, WithStore(store))
+
+	id, err := orders.Create(ctx, testOrder{Title: "first"})
+	require.NoError(t, err)
+
+	require.NoError(t, users.Flush(ctx))
+
+	_, ok := orders.get(ctx, id)
+	assert.True(t, ok, "flushing users must not drop other entities")
+
+	require.NoError(t, orders.Flush(ctx))
+	_, ok = orders.get(ctx, id)
+	assert.False(t, ok)
+}
+
+func TestEntity_LoadSpanLinksWaiters(t *testing.T) {
+	repo := &blockingOrderRepo{fakeOrderRepo: newFakeOrderRepo(), release: make(chan struct{})}
+	repo.orders[1] = testOrder{ID: 1, Title: "first"}
+	orders := NewEntity[int, testOrder](repo, NewMemoryStore(0, 0, PolicyLRU), EntityConfig[int, testOrder]{
+		Name: "order",
+		Key:  func(o testOrder) int { return o.ID },
+		TTL:  time.Minute,
+	})
+
+	var wg sync.WaitGroup
+	waiters := make([]trace.TraceID, 2)
+	for i := range waiters {
+		ctx, span := tracing.Start(context.Background(), "waiter")
+		waiters[i] = span.SpanContext().TraceID()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer span.End()
+			o, err := orders.Get(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, "first", o.Title)
+		}()
+		waitForWaiters(t, orders, 1, i+1)
+	}
+	close(repo.release)
+	wg.Wait()
+
+	var load sdktrace.ReadOnlySpan
+	for _, span := range spans.Ended() {
+		if span.Name() != "Cache.LoadOrder" || len(span.Links()) == 0 {
+			continue
+		}
+		if span.Links()[0].SpanContext.TraceID() == waiters[0] {
+			load = span
+		}
+	}
+	require.NotNil(t, load, "shared load should have its own span linked to the waiters")
+	assert.False(t, load.Parent().IsValid(), "shared load span should be a root")
+
+	var linked []trace.TraceID
+	for _, link := range load.Links() {
+		linked = append(linked, link.SpanContext.TraceID())
+	}
+	assert.ElementsMatch(t, waiters, linked)
+	assert.Contains(t, load.Attributes(), attribute.Int("cache.waiters", 2))
+	assert.Equal(t, 1, repo.gets)
+}
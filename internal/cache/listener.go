@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"app/config"
+	"app/internal/repository"
+	"app/internal/storage"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultListenMinBackoff = 500 * time.Millisecond
+	defaultListenMaxBackoff = 30 * time.Second
+)
+
+type invalidator interface {
+	Invalidate(ctx context.Context, ids ...string)
+	Flush(ctx context.Context) error
+}
+
+// Listener keeps a cache consistent with writes made by other replicas. It
+// holds a dedicated connection that LISTENs on repository.UserChangesChannel
+// and invalidates the users of every notification, except those sent for
+// writes made with origin as application_name, which the cache already
+// reflects.
+type Listener struct {
+	connString string
+	origin     string
+	target     invalidator
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func NewListener(connString, origin string, target invalidator, cfg config.InvalidationConfig) *Listener {
+	l := &Listener{
+		connString: connString,
+		origin:     origin,
+		target:     target,
+		minBackoff: cfg.MinBackoff,
+		maxBackoff: cfg.MaxBackoff,
+	}
+	if l.minBackoff <= 0 {
+		l.minBackoff = defaultListenMinBackoff
+	}
+	if l.maxBackoff < l.minBackoff {
+		l.maxBackoff = max(defaultListenMaxBackoff, l.minBackoff)
+	}
+	return l
+}
+
+// Run listens until ctx is done, reconnecting with exponential backoff. Any
+// notification sent while no session was listening is lost, so after every
+// reconnect the whole cache is flushed.
+func (l *Listener) Run(ctx context.Context) {
+	backoff := l.minBackoff
+	resync := false
+	for {
+		established, err := l.listen(ctx, resync)
+		if ctx.Err() != nil {
+			slog.Info("Cache invalidation listener stopped")
+			return
+		}
+		resync = true
+		if established {
+			backoff = l.minBackoff
+		}
+
+		wait := jitter(backoff)
+		slog.Warn("Cache invalidation listener disconnected", "error", err, "retry_in", wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			slog.Info("Cache invalidation listener stopped")
+			return
+		}
+		backoff = min(backoff*2, l.maxBackoff)
+	}
+}
+
+// listen runs one LISTEN session. established reports whether the session got
+// as far as listening, which resets the backoff.
+func (l *Listener) listen(ctx context.Context, resync bool) (established bool, err error) {
+	conn, err := storage.GetConn(ctx, l.connString)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = conn.Close(closeCtx)
+	}()
+
+	channel := pgx.Identifier{repository.UserChangesChannel}.Sanitize()
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return false, errors.Wrap(err, "listen for user changes")
+	}
+	slog.Info("Cache invalidation listener connected", "channel", repository.UserChangesChannel)
+
+	if resync {
+		if err := l.target.Flush(ctx); err != nil {
+			return true, errors.Wrap(err, "resync cache after reconnect")
+		}
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, errors.Wrap(err, "wait for notification")
+		}
+		if err := l.handle(ctx, n.Payload); err != nil {
+			return true, err
+		}
+	}
+}
+
+// handle invalidates the users of one notification. A payload it cannot read
+// flushes the cache, since the users it names are unknown.
+func (l *Listener) handle(ctx context.Context, payload string) error {
+	var changes repository.UserChanges
+	if err := json.Unmarshal([]byte(payload), &changes); err != nil {
+		slog.Warn("Cache invalidation listener got an unreadable notification, flushing", "error", err)
+		return errors.Wrap(l.target.Flush(ctx), "flush cache after unreadable notification")
+	}
+	if changes.Origin == l.origin || len(changes.IDs) == 0 {
+		return nil
+	}
+	l.target.Invalidate(ctx, changes.IDs...)
+	return nil
+}
+
+// jitter spreads reconnects of many replicas over [d/2, d).
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(half) //nolint:gosec // reconnect jitter does not need a CSPRNG
+}
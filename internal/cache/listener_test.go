@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"app/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingInvalidator struct {
+	calls   [][]string
+	flushes int
+}
+
+func (r *recordingInvalidator) Invalidate(_ context.Context, ids ...string) {
+	r.calls = append(r.calls, ids)
+}
+
+func (r *recordingInvalidator) Flush(context.Context) error {
+	r.flushes++
+	return nil
+}
+
+func TestListener_Handle(t *testing.T) {
+	target := &recordingInvalidator{}
+	l := NewListener("", "replica-a", target, config.InvalidationConfig{})
+	ctx := context.Background()
+
+	require.NoError(t, l.handle(ctx, `{"origin":"replica-b","ids":["1","2","3"]}`))
+	require.NoError(t, l.handle(ctx, `{"origin":"replica-a","ids":["4"]}`))
+	require.NoError(t, l.handle(ctx, `{"origin":"psql","ids":[]}`))
+
+	assert.Equal(t, [][]string{{"1", "2", "3"}}, target.calls,
+		"one call per notification, none for this replica's own writes")
+	assert.Zero(t, target.flushes)
+
+	require.NoError(t, l.handle(ctx, "5"))
+	assert.Equal(t, 1, target.flushes, "an unreadable payload flushes the cache")
+}
@@ -0,0 +1,427 @@
+package cache
+
+import (
+	"container/heap"
+	"context"
+	"hash/maphash"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"app/internal/metrics"
+)
+
+// entryOverhead approximates the per-entry bookkeeping cost (map slot, entry
+// struct, policy node) that is added to the payload size for the byte budget.
+const entryOverhead = 128
+
+const (
+	// defaultShards is the shard count used when none is configured.
+	defaultShards = 16
+	// minShardEntries and minShardBytes stop a bounded store from being split
+	// so finely that per-shard eviction no longer approximates the policy
+	// over the whole store.
+	minShardEntries = 1024
+	minShardBytes   = 1 << 20
+	// cleanupBatch caps how many expired entries CleanupExpired removes per
+	// shard lock acquisition, so readers of that shard are never blocked for
+	// a whole sweep.
+	cleanupBatch = 256
+)
+
+// MemoryStore is a process-local Store with optional entry and byte bounds.
+// Keys are spread over shards that lock, evict and expire independently.
+type MemoryStore struct {
+	seed   maphash.Seed
+	shards []*memoryShard
+}
+
+type memoryShard struct {
+	mu      sync.RWMutex
+	items   map[string]*memoryItem
+	expiry  expiryQueue
+	name    string
+	policy  evictionPolicy
+	bytes   int64
+	entries int
+	maxSize int64
+}
+
+type memoryItem struct {
+	key       string
+	value     []byte
+	expiredAt time.Time
+	size      int64
+	index     int
+}
+
+// NewMemoryStore creates an in-process store with a shard count suited to
+// its bounds. Zero maxEntries and maxBytes leave it unbounded, in which case
+// policy is ignored.
+func NewMemoryStore(maxEntries int, maxBytes int64, policy string) *MemoryStore {
+	return NewShardedMemoryStore(0, maxEntries, maxBytes, policy)
+}
+
+// NewShardedMemoryStore is NewMemoryStore with an explicit shard count.
+// The bounds are divided between the shards; zero shards picks a default.
+// The count is capped so that every shard of a bounded store gets a share of
+// each bound; a shard left with none would be unbounded.
+func NewShardedMemoryStore(shards, maxEntries int, maxBytes int64, policy string) *MemoryStore {
+	if shards <= 0 {
+		shards = shardCount(maxEntries, maxBytes)
+	}
+	if maxEntries > 0 && shards > maxEntries {
+		shards = maxEntries
+	}
+	if maxBytes > 0 && int64(shards) > maxBytes {
+		shards = int(maxBytes)
+	}
+	s := &MemoryStore{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*memoryShard, shards),
+	}
+	for i := range s.shards {
+		sh := &memoryShard{
+			items:   make(map[string]*memoryItem),
+			name:    policy,
+			entries: split(maxEntries, shards, i),
+			maxSize: split(maxBytes, shards, i),
+		}
+		if sh.bounded() {
+			sh.policy = newPolicy(policy, sh.entries)
+		}
+		s.shards[i] = sh
+	}
+	return s
+}
+
+// shardCount halves defaultShards until every shard keeps a useful share of
+// the bounds.
+func shardCount(maxEntries int, maxBytes int64) int {
+	n := defaultShards
+	for n > 1 && ((maxEntries > 0 && maxEntries/n < minShardEntries) ||
+		(maxBytes > 0 && maxBytes/int64(n) < minShardBytes)) {
+		n /= 2
+	}
+	return n
+}
+
+// split returns shard i's part of total, spreading the remainder over the
+// first shards.
+func split[T int | int64](total T, shards, i int) T {
+	part := total / T(shards)
+	if T(i) < total%T(shards) {
+		part++
+	}
+	return part
+}
+
+func (s *MemoryStore) shard(key string) *memoryShard {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
+	return s.shards[maphash.String(s.seed, key)%uint64(len(s.shards))]
+}
+
+func (sh *memoryShard) bounded() bool {
+	return sh.entries > 0 || sh.maxSize > 0
+}
+
+func itemSize(key string, value []byte) int64 {
+	return int64(len(key)+len(value)) + entryOverhead
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	sh := s.shard(key)
+	if sh.policy != nil {
+		return sh.getTracked(key)
+	}
+
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	item, ok := sh.items[key]
+	if !ok || time.Now().After(item.expiredAt) {
+		return nil, false, nil
+	}
+	return item.value, true, nil
+}
+
+// getTracked is Get for bounded shards, where every hit updates the policy
+// and therefore needs the write lock.
+func (sh *memoryShard) getTracked(key string) ([]byte, bool, error) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	item, ok := sh.items[key]
+	if !ok || time.Now().After(item.expiredAt) {
+		return nil, false, nil
+	}
+	sh.policy.touch(key)
+	return item.value, true, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.set(key, value, ttl)
+	return nil
+}
+
+func (s *MemoryStore) Add(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if item, ok := sh.items[key]; ok && time.Now().Before(item.expiredAt) {
+		return false, nil
+	}
+	return sh.set(key, value, ttl), nil
+}
+
+// set stores value under key and reports whether it was kept; a bounded
+// shard may reject it. Callers hold sh.mu.
+func (sh *memoryShard) set(key string, value []byte, ttl time.Duration) bool {
+	item := &memoryItem{
+		key:       key,
+		value:     value,
+		expiredAt: time.Now().Add(ttl),
+		size:      itemSize(key, value),
+	}
+
+	if old, ok := sh.items[key]; ok {
+		sh.replace(old, item)
+		if sh.policy != nil {
+			sh.policy.add(key)
+			sh.evictOverflow(key)
+		}
+		return true
+	}
+
+	if sh.policy == nil {
+		sh.insert(item)
+		return true
+	}
+
+	if sh.maxSize > 0 && item.size > sh.maxSize {
+		metrics.IncCacheOversized()
+		slog.Warn("Cache entry larger than shard budget - not stored", "key", key, "size", item.size, "budget", sh.maxSize)
+		return false
+	}
+	now := time.Now()
+	admitted := false
+	for sh.overflows(item.size) {
+		if sh.expireHead(now) {
+			continue
+		}
+		victim, ok := sh.policy.victim("")
+		if !ok {
+			break
+		}
+		if !admitted {
+			if !sh.policy.admit(key, victim) {
+				slog.Debug("Cache admission rejected", "key", key, "victim", victim)
+				return false
+			}
+			admitted = true
+		}
+		sh.evict(victim)
+	}
+
+	sh.insert(item)
+	sh.policy.add(key)
+	return true
+}
+
+// insert adds a new item. Callers hold sh.mu.
+func (sh *memoryShard) insert(item *memoryItem) {
+	sh.items[item.key] = item
+	sh.bytes += item.size
+	heap.Push(&sh.expiry, item)
+}
+
+// replace swaps old for item under the same key. Callers hold sh.mu.
+func (sh *memoryShard) replace(old, item *memoryItem) {
+	item.index = old.index
+	sh.expiry[item.index] = item
+	heap.Fix(&sh.expiry, item.index)
+	sh.items[item.key] = item
+	sh.bytes += item.size - old.size
+}
+
+func (sh *memoryShard) overflows(incoming int64) bool {
+	if sh.entries > 0 && len(sh.items)+1 > sh.entries {
+		return true
+	}
+	return sh.maxSize > 0 && sh.bytes+incoming > sh.maxSize
+}
+
+// evictOverflow shrinks the shard after an in-place update grew an entry,
+// never evicting the entry that was just written.
+func (sh *memoryShard) evictOverflow(keep string) {
+	now := time.Now()
+	for sh.maxSize > 0 && sh.bytes > sh.maxSize {
+		if sh.expireHead(now) {
+			continue
+		}
+		victim, ok := sh.policy.victim(keep)
+		if !ok {
+			return
+		}
+		sh.evict(victim)
+	}
+}
+
+// expireHead removes the entry that expires first if it expired before now,
+// so dead entries make room before live ones are evicted. Callers hold sh.mu.
+func (sh *memoryShard) expireHead(now time.Time) bool {
+	if len(sh.expiry) == 0 || !now.After(sh.expiry[0].expiredAt) {
+		return false
+	}
+	key := sh.expiry[0].key
+	sh.remove(key)
+	metrics.IncCacheExpired()
+	slog.Debug("Cache expired - entry removed", "key", key)
+	return true
+}
+
+func (sh *memoryShard) evict(key string) {
+	sh.remove(key)
+	metrics.IncCacheCapacityEvictions()
+	slog.Debug("Cache evicted - capacity reached", "key", key, "policy", sh.name)
+}
+
+// remove drops an item and its bookkeeping. Callers hold sh.mu.
+func (sh *memoryShard) remove(key string) {
+	item, ok := sh.items[key]
+	if !ok {
+		return
+	}
+	delete(sh.items, key)
+	heap.Remove(&sh.expiry, item.index)
+	sh.bytes -= item.size
+	if sh.policy != nil {
+		sh.policy.remove(key)
+	}
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.remove(key)
+	return nil
+}
+
+func (s *MemoryStore) DeletePrefix(_ context.Context, prefix string) error {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key := range sh.items {
+			if strings.HasPrefix(key, prefix) {
+				sh.remove(key)
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return nil
+}
+
+func (s *MemoryStore) Range(_ context.Context, prefix string, fn func(key string, value []byte) bool) error {
+	type kv struct {
+		key   string
+		value []byte
+	}
+
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		now := time.Now()
+		matched := make([]kv, 0)
+		for key, item := range sh.items {
+			if strings.HasPrefix(key, prefix) && now.Before(item.expiredAt) {
+				matched = append(matched, kv{key: key, value: item.value})
+			}
+		}
+		sh.mu.RUnlock()
+
+		for _, e := range matched {
+			if !fn(e.key, e.value) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) TTL(_ context.Context, key string) (time.Duration, bool, error) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	item, ok := sh.items[key]
+	if !ok {
+		return 0, false, nil
+	}
+	ttl := time.Until(item.expiredAt)
+	if ttl <= 0 {
+		return 0, false, nil
+	}
+	return ttl, true, nil
+}
+
+// CleanupExpired removes expired entries shard by shard, taking each shard's
+// lock for at most cleanupBatch removals at a time. Only expired entries are
+// visited.
+func (s *MemoryStore) CleanupExpired() {
+	for _, sh := range s.shards {
+		for {
+			if !sh.cleanupBatch(time.Now()) {
+				break
+			}
+		}
+	}
+}
+
+// cleanupBatch removes up to cleanupBatch entries that expired before now
+// and reports whether more may remain.
+func (sh *memoryShard) cleanupBatch(now time.Time) bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	for i := 0; i < cleanupBatch; i++ {
+		if !sh.expireHead(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// expiryQueue is a min-heap of a shard's items by expiry time.
+type expiryQueue []*memoryItem
+
+func (q expiryQueue) Len() int { return len(q) }
+
+func (q expiryQueue) Less(i, j int) bool { return q[i].expiredAt.Before(q[j].expiredAt) }
+
+func (q expiryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *expiryQueue) Push(x any) {
+	item := x.(*memoryItem)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustSet(t *testing.T, s Store, key string) {
+	t.Helper()
+	require.NoError(t, s.Set(context.Background(), key, []byte("value-"+key), 10*time.Minute))
+}
+
+func has(t *testing.T, s Store, key string) bool {
+	t.Helper()
+	_, ok, err := s.Get(context.Background(), key)
+	require.NoError(t, err)
+	return ok
+}
+
+func TestMemoryStore_MaxEntries_LRU(t *testing.T) {
+	s := NewMemoryStore(2, 0, PolicyLRU)
+
+	mustSet(t, s, "1")
+	mustSet(t, s, "2")
+	require.True(t, has(t, s, "1"))
+
+	mustSet(t, s, "3")
+
+	assert.False(t, has(t, s, "2"), "least recently used entry should be evicted")
+	assert.True(t, has(t, s, "1"))
+	assert.True(t, has(t, s, "3"))
+	assert.Len(t, s.shards[0].items, 2)
+}
+
+func TestMemoryStore_MaxEntries_LFU(t *testing.T) {
+	s := NewMemoryStore(2, 0, PolicyLFU)
+
+	mustSet(t, s, "1")
+	mustSet(t, s, "2")
+	for i := 0; i < 3; i++ {
+		require.True(t, has(t, s, "1"))
+	}
+	require.True(t, has(t, s, "2"))
+
+	mustSet(t, s, "3")
+
+	assert.False(t, has(t, s, "2"), "least frequently used entry should be evicted")
+	assert.True(t, has(t, s, "1"))
+}
+
+func TestMemoryStore_MaxEntries_TinyLFUAdmission(t *testing.T) {
+	s := NewMemoryStore(1, 0, PolicyTinyLFU)
+
+	mustSet(t, s, "hot")
+	for i := 0; i < 5; i++ {
+		require.True(t, has(t, s, "hot"))
+	}
+
+	mustSet(t, s, "cold")
+
+	assert.False(t, has(t, s, "cold"), "one-hit key should not displace a frequently used one")
+	assert.True(t, has(t, s, "hot"))
+}
+
+func TestMemoryStore_MaxBytes(t *testing.T) {
+	s := NewMemoryStore(0, itemSize("1", []byte("value-1")), PolicyLRU)
+
+	mustSet(t, s, "1")
+	mustSet(t, s, "2")
+
+	assert.False(t, has(t, s, "1"))
+	assert.True(t, has(t, s, "2"))
+	assert.LessOrEqual(t, s.shards[0].bytes, s.shards[0].maxSize)
+}
+
+func TestMemoryStore_GrownEntryEvictsOthers(t *testing.T) {
+	s := NewMemoryStore(0, 3*itemSize("a", []byte("value-a")), PolicyLFU)
+	ctx := context.Background()
+
+	mustSet(t, s, "a")
+	mustSet(t, s, "b")
+	mustSet(t, s, "c")
+	for i := 0; i < 3; i++ {
+		require.True(t, has(t, s, "b"))
+		require.True(t, has(t, s, "c"))
+	}
+	// "a" is now the least frequently used entry, so the policy's first
+	// victim is the entry being grown.
+	require.NoError(t, s.Set(ctx, "a", make([]byte, 100), time.Minute))
+
+	assert.LessOrEqual(t, s.shards[0].bytes, s.shards[0].maxSize)
+	assert.Len(t, s.shards[0].items, 2)
+	assert.True(t, has(t, s, "a"))
+}
+
+func TestMemoryStore_ExpiredEntriesMakeRoomFirst(t *testing.T) {
+	s := NewMemoryStore(2, 0, PolicyLRU)
+	ctx := context.Background()
+
+	mustSet(t, s, "live")
+	require.NoError(t, s.Set(ctx, "dead", []byte("v"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	mustSet(t, s, "new")
+
+	assert.True(t, has(t, s, "live"), "a live entry must not be evicted while an expired one takes space")
+	assert.True(t, has(t, s, "new"))
+	assert.Len(t, s.shards[0].items, 2)
+}
+
+func TestMemoryStore_Delete_ReleasesCapacity(t *testing.T) {
+	s := NewMemoryStore(1, 0, PolicyLRU)
+
+	mustSet(t, s, "1")
+	require.NoError(t, s.Delete(context.Background(), "1"))
+
+	assert.Zero(t, s.shards[0].bytes)
+	assert.Empty(t, s.shards[0].policy.(*lruPolicy).items)
+}
+
+func TestMemoryStore_TTL(t *testing.T) {
+	s := NewMemoryStore(0, 0, PolicyLRU)
+	ctx := context.Background()
+
+	require.NoError(t, s.Set(ctx, "1", []byte("v"), time.Minute))
+
+	ttl, ok, err := s.TTL(ctx, "1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+	_, ok, err = s.TTL(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, PolicyLRU, p)
+
+	p, err = ParsePolicy(" TinyLFU ")
+	require.NoError(t, err)
+	assert.Equal(t, PolicyTinyLFU, p)
+
+	_, err = ParsePolicy("fifo")
+	assert.Error(t, err)
+}
+
+func TestMemoryStore_ShardCount(t *testing.T) {
+	assert.Equal(t, defaultShards, len(NewMemoryStore(0, 0, PolicyLRU).shards))
+	assert.Equal(t, 1, len(NewMemoryStore(2, 0, PolicyLRU).shards), "small bounds should not be split")
+	assert.Equal(t, 4, len(NewMemoryStore(4*minShardEntries, 0, PolicyLRU).shards))
+	assert.Equal(t, 2, len(NewMemoryStore(0, 2*minShardBytes, PolicyLRU).shards))
+	assert.Equal(t, 3, len(NewShardedMemoryStore(3, 0, 0, PolicyLRU).shards))
+}
+
+func TestMemoryStore_ShardsSplitBounds(t *testing.T) {
+	s := NewShardedMemoryStore(3, 10, 0, PolicyLRU)
+
+	total := 0
+	for _, sh := range s.shards {
+		total += sh.entries
+	}
+	assert.Equal(t, 10, total)
+
+	for i := 0; i < 100; i++ {
+		mustSet(t, s, strconv.Itoa(i))
+	}
+	size := 0
+	for _, sh := range s.shards {
+		assert.LessOrEqual(t, len(sh.items), sh.entries)
+		size += len(sh.items)
+	}
+	assert.Equal(t, 10, size)
+}
+
+func TestMemoryStore_MoreShardsThanBound(t *testing.T) {
+	s := NewShardedMemoryStore(16, 10, 0, PolicyLRU)
+	assert.Len(t, s.shards, 10)
+	for _, sh := range s.shards {
+		assert.True(t, sh.bounded())
+	}
+
+	for i := 0; i < 100; i++ {
+		mustSet(t, s, strconv.Itoa(i))
+	}
+	size := 0
+	for _, sh := range s.shards {
+		size += len(sh.items)
+	}
+	assert.Equal(t, 10, size)
+}
+
+func TestMemoryStore_CleanupExpired(t *testing.T) {
+	s := NewShardedMemoryStore(4, 0, 0, PolicyLRU)
+	ctx := context.Background()
+
+	for i := 0; i < 3*cleanupBatch; i++ {
+		require.NoError(t, s.Set(ctx, "short-"+strconv.Itoa(i), []byte("v"), time.Millisecond))
+		mustSet(t, s, "long-"+strconv.Itoa(i))
+	}
+	// Rewriting an entry with a longer TTL must move it in the expiry queue.
+	require.NoError(t, s.Set(ctx, "short-0", []byte("v"), time.Minute))
+	time.Sleep(5 * time.Millisecond)
+
+	s.CleanupExpired()
+
+	remaining := 0
+	for _, sh := range s.shards {
+		assert.Len(t, sh.expiry, len(sh.items))
+		remaining += len(sh.items)
+	}
+	assert.Equal(t, 3*cleanupBatch+1, remaining)
+	assert.True(t, has(t, s, "short-0"))
+	assert.False(t, has(t, s, "short-1"))
+	assert.True(t, has(t, s, "long-1"))
+}
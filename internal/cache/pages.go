@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"app/internal/models"
+	"app/internal/tracing"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// List pages are stored under the current generation. Every write replaces
+// the generation with a fresh token, so pages cached before the write can no
+// longer be addressed and simply age out.
+const (
+	pageKeyPrefix = "userpage:"
+	generationKey = pageKeyPrefix + "gen"
+	generationTTL = 24 * time.Hour
+)
+
+// WithPageTTL enables caching of GetAll pages for ttl. Zero disables it.
+func WithPageTTL(ttl time.Duration) Option {
+	return func(c *Decorator) {
+		c.pageTTL = ttl
+	}
+}
+
+func pageKey(generation string, q models.UserQuery) string {
+	return pageKeyPrefix + generation + ":" + q.CacheKey()
+}
+
+func countKey(generation string, filter models.UserFilter) string {
+	return pageKeyPrefix + generation + ":count:" + filter.String()
+}
+
+// generation returns the current page generation, creating one if none is
+// stored yet.
+func (c *Decorator) generation(ctx context.Context) (string, error) {
+	data, ok, err := c.store.Get(ctx, generationKey)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return string(data), nil
+	}
+
+	generation := uuid.NewString()
+	if err := c.store.Set(ctx, generationKey, []byte(generation), generationTTL); err != nil {
+		return "", err
+	}
+	return generation, nil
+}
+
+// bumpGeneration makes every cached page unreachable.
+func (c *Decorator) bumpGeneration(ctx context.Context) {
+	if c.pageTTL <= 0 {
+		return
+	}
+	if err := c.store.Set(ctx, generationKey, []byte(uuid.NewString()), generationTTL); err != nil {
+		slog.Error("Cache: failed to bump page generation", "error", err)
+	}
+}
+
+func (c *Decorator) getPage(ctx context.Context, key string) ([]*models.User, bool) {
+	data, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		slog.Warn("Cache: failed to read page", "key", key, "error", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+
+	var users []*models.User
+	if err := json.Unmarshal(data, &users); err != nil {
+		slog.Warn("Cache: failed to decode page", "key", key, "error", err)
+		return nil, false
+	}
+	return users, true
+}
+
+func (c *Decorator) setPage(ctx context.Context, key string, users []*models.User) {
+	data, err := json.Marshal(users)
+	if err != nil {
+		slog.Error("Cache: failed to encode page", "key", key, "error", err)
+		return
+	}
+	if err := c.store.Set(ctx, key, data, c.pageTTL); err != nil {
+		slog.Warn("Cache: failed to store page", "key", key, "error", err)
+	}
+}
+
+func (c *Decorator) getAllCached(ctx context.Context, q models.UserQuery) ([]*models.User, error) {
+	generation, err := c.generation(ctx)
+	if err != nil {
+		slog.Warn("Cache: page generation unavailable, bypassing page cache", "error", err)
+		return c.repo.GetAll(ctx, q)
+	}
+
+	key := pageKey(generation, q)
+	if users, ok := c.getPage(ctx, key); ok {
+		slog.Debug("Page cache hit", "query", q.CacheKey())
+		return users, nil
+	}
+
+	result, err := c.shareAll(ctx, key, func(ctx context.Context) (any, error) {
+		if users, ok := c.getPage(ctx, key); ok {
+			return users, nil
+		}
+
+		users, err := c.repo.GetAll(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		// A write that landed while the page was loading has already bumped
+		// the generation; its users may be older than what the write cached.
+		if current, err := c.generation(ctx); err != nil || current != generation {
+			return users, nil
+		}
+		c.setPage(ctx, key, users)
+		c.fillUsers(ctx, generation, users)
+		slog.Debug("Page loaded from repo", "query", q.CacheKey(), "count", len(users))
+		return users, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]*models.User), nil
+}
+
+// fillUsers caches the users of a page loaded under generation by id. Users
+// already cached are left alone, since a write may have cached a newer copy.
+// A write can still land between the generation check and the fill; if the
+// generation has moved once the users are cached they are dropped again.
+func (c *Decorator) fillUsers(ctx context.Context, generation string, users []*models.User) {
+	added := make([]string, 0, len(users))
+	for _, user := range users {
+		// Listings that include deleted users must not make them readable
+		// by id.
+		if user.DeletedAt == nil && c.users.add(ctx, user) {
+			added = append(added, user.ID)
+		}
+	}
+	if current, err := c.generation(ctx); err == nil && current == generation {
+		return
+	}
+	for _, id := range added {
+		c.users.Invalidate(ctx, id)
+	}
+}
+
+// Count caches user counts under the page generation, so they are dropped by
+// the same writes that drop list pages.
+func (c *Decorator) Count(ctx context.Context, filter models.UserFilter) (models.UserCount, error) {
+	ctx, span := tracing.Start(ctx, "Cache.CountUsers")
+	defer span.End()
+
+	if c.pageTTL <= 0 {
+		return c.repo.Count(ctx, filter)
+	}
+	generation, err := c.generation(ctx)
+	if err != nil {
+		slog.Warn("Cache: page generation unavailable, bypassing count cache", "error", err)
+		return c.repo.Count(ctx, filter)
+	}
+
+	key := countKey(generation, filter)
+	if count, ok := c.getCount(ctx, key); ok {
+		return count, nil
+	}
+
+	result, err := c.shareAll(ctx, key, func(ctx context.Context) (any, error) {
+		if count, ok := c.getCount(ctx, key); ok {
+			return count, nil
+		}
+		count, err := c.repo.Count(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if current, err := c.generation(ctx); err == nil && current == generation {
+			c.setCount(ctx, key, count)
+		}
+		return count, nil
+	})
+	if err != nil {
+		return models.UserCount{}, err
+	}
+	return result.(models.UserCount), nil
+}
+
+func (c *Decorator) getCount(ctx context.Context, key string) (models.UserCount, bool) {
+	data, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		slog.Warn("Cache: failed to read count", "key", key, "error", err)
+		return models.UserCount{}, false
+	}
+	if !ok {
+		return models.UserCount{}, false
+	}
+
+	var count models.UserCount
+	if err := json.Unmarshal(data, &count); err != nil {
+		slog.Warn("Cache: failed to decode count", "key", key, "error", err)
+		return models.UserCount{}, false
+	}
+	return count, true
+}
+
+func (c *Decorator) setCount(ctx context.Context, key string, count models.UserCount) {
+	data, err := json.Marshal(count)
+	if err != nil {
+		slog.Error("Cache: failed to encode count", "key", key, "error", err)
+		return
+	}
+	if err := c.store.Set(ctx, key, data, c.pageTTL); err != nil {
+		slog.Warn("Cache: failed to store count", "key", key, "error", err)
+	}
+}
+
+// shareAll runs fn once for all concurrent callers of key, like Entity.share:
+// fn gets a context detached from every caller and bounded by the load timeout,
+// and each caller stops waiting once its own ctx is done.
+func (c *Decorator) shareAll(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (any, error) {
+	loaded := c.groupAll.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.loadTimeout)
+		defer cancel()
+		return fn(ctx)
+	})
+	select {
+	case res := <-loaded:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "wait for %s", key)
+	}
+}
+
+func (c *Decorator) flushPages(ctx context.Context) error {
+	return c.store.DeletePrefix(ctx, pageKeyPrefix)
+}
@@ -0,0 +1,316 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"hash/maphash"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Policy names accepted by ParsePolicy and config.CacheConfig.EvictionPolicy.
+const (
+	PolicyLRU     = "lru"
+	PolicyLFU     = "lfu"
+	PolicyTinyLFU = "tinylfu"
+)
+
+// evictionPolicy tracks key usage for a bounded cache. Implementations are not
+// safe for concurrent use; the owning cache serializes access.
+type evictionPolicy interface {
+	// add registers a key that has just been inserted.
+	add(key string)
+	// touch records a read of an existing key.
+	touch(key string)
+	// remove forgets a key that left the cache for any reason.
+	remove(key string)
+	// victim returns the key that should be evicted next, other than skip.
+	victim(skip string) (string, bool)
+	// admit reports whether candidate may replace victim.
+	admit(candidate, victim string) bool
+}
+
+// ParsePolicy validates a policy name. An empty name selects LRU.
+func ParsePolicy(name string) (string, error) {
+	switch p := strings.ToLower(strings.TrimSpace(name)); p {
+	case "":
+		return PolicyLRU, nil
+	case PolicyLRU, PolicyLFU, PolicyTinyLFU:
+		return p, nil
+	default:
+		return "", errors.Errorf("unknown eviction policy %q", name)
+	}
+}
+
+func newPolicy(name string, capacity int) evictionPolicy {
+	switch name {
+	case PolicyLFU:
+		return newLFU()
+	case PolicyTinyLFU:
+		return newTinyLFU(capacity)
+	default:
+		return newLRU()
+	}
+}
+
+type lruPolicy struct {
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newLRU() *lruPolicy {
+	return &lruPolicy{
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (p *lruPolicy) add(key string) {
+	if el, ok := p.items[key]; ok {
+		p.order.MoveToFront(el)
+		return
+	}
+	p.items[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) touch(key string) {
+	if el, ok := p.items[key]; ok {
+		p.order.MoveToFront(el)
+	}
+}
+
+func (p *lruPolicy) remove(key string) {
+	if el, ok := p.items[key]; ok {
+		p.order.Remove(el)
+		delete(p.items, key)
+	}
+}
+
+func (p *lruPolicy) victim(skip string) (string, bool) {
+	el := p.order.Back()
+	if el != nil && el.Value.(string) == skip {
+		el = el.Prev()
+	}
+	if el == nil {
+		return "", false
+	}
+	return el.Value.(string), true
+}
+
+func (p *lruPolicy) admit(string, string) bool {
+	return true
+}
+
+// lfuPolicy evicts the least frequently used key, breaking ties by recency.
+type lfuPolicy struct {
+	tick  uint64
+	heap  lfuHeap
+	items map[string]*lfuItem
+}
+
+type lfuItem struct {
+	key   string
+	freq  uint64
+	tick  uint64
+	index int
+}
+
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	item := x.(*lfuItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+func newLFU() *lfuPolicy {
+	return &lfuPolicy{items: make(map[string]*lfuItem)}
+}
+
+func (p *lfuPolicy) add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.touch(key)
+		return
+	}
+	p.tick++
+	item := &lfuItem{key: key, freq: 1, tick: p.tick}
+	p.items[key] = item
+	heap.Push(&p.heap, item)
+}
+
+func (p *lfuPolicy) touch(key string) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+	p.tick++
+	item.freq++
+	item.tick = p.tick
+	heap.Fix(&p.heap, item.index)
+}
+
+func (p *lfuPolicy) remove(key string) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&p.heap, item.index)
+	delete(p.items, key)
+}
+
+func (p *lfuPolicy) victim(skip string) (string, bool) {
+	if len(p.heap) == 0 {
+		return "", false
+	}
+	if p.heap[0].key != skip {
+		return p.heap[0].key, true
+	}
+	// The next least frequently used key is one of the root's children.
+	switch len(p.heap) {
+	case 1:
+		return "", false
+	case 2:
+		return p.heap[1].key, true
+	}
+	if p.heap.Less(2, 1) {
+		return p.heap[2].key, true
+	}
+	return p.heap[1].key, true
+}
+
+func (p *lfuPolicy) admit(string, string) bool {
+	return true
+}
+
+// tinyLFUPolicy keeps keys in LRU order but only admits a new key when its
+// estimated access frequency beats that of the LRU victim.
+type tinyLFUPolicy struct {
+	lru    *lruPolicy
+	sketch *countMinSketch
+	// admitted is the candidate already counted by the last admit call.
+	admitted string
+}
+
+func newTinyLFU(capacity int) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		lru:    newLRU(),
+		sketch: newCountMinSketch(capacity),
+	}
+}
+
+func (p *tinyLFUPolicy) add(key string) {
+	if key != p.admitted {
+		p.sketch.increment(key)
+	}
+	p.admitted = ""
+	p.lru.add(key)
+}
+
+func (p *tinyLFUPolicy) touch(key string) {
+	p.sketch.increment(key)
+	p.lru.touch(key)
+}
+
+func (p *tinyLFUPolicy) remove(key string) {
+	p.lru.remove(key)
+}
+
+func (p *tinyLFUPolicy) victim(skip string) (string, bool) {
+	return p.lru.victim(skip)
+}
+
+func (p *tinyLFUPolicy) admit(candidate, victim string) bool {
+	p.sketch.increment(candidate)
+	p.admitted = candidate
+	return p.sketch.estimate(candidate) > p.sketch.estimate(victim)
+}
+
+const (
+	sketchDepth    = 4
+	sketchMinWidth = 64
+	sketchMaxCount = 15
+)
+
+// countMinSketch is a small 4-bit-saturating frequency estimator. Counters are
+// halved once the number of increments reaches the sample size so that old
+// popularity fades out.
+type countMinSketch struct {
+	seeds     [sketchDepth]maphash.Seed
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	sample    int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := sketchMinWidth
+	for width < capacity {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		mask:   uint64(width - 1),
+		sample: 10 * width,
+	}
+	for i := range s.rows {
+		s.seeds[i] = maphash.MakeSeed()
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i := range s.rows {
+		idx := maphash.String(s.seeds[i], key) & s.mask
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sample {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	est := uint8(sketchMaxCount)
+	for i := range s.rows {
+		if v := s.rows[i][maphash.String(s.seeds[i], key)&s.mask]; v < est {
+			est = v
+		}
+	}
+	return est
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
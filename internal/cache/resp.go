@@ -0,0 +1,455 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"app/config"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	respScanCount          = "500"
+	defaultRESPPoolSize    = 8
+	defaultRESPDialTimeout = time.Second
+	defaultRESPTimeout     = time.Second
+)
+
+// RESPStore is a Store backed by any server speaking the Redis protocol
+// (Redis, Valkey, KeyDB, Dragonfly). It opens at most pool size connections
+// and keeps them for reuse; callers beyond that wait for one to be released.
+type RESPStore struct {
+	addr        string
+	password    string
+	db          int
+	dialTimeout time.Duration
+	timeout     time.Duration
+
+	// slots holds a token for every connection in use.
+	slots chan struct{}
+
+	mu     sync.Mutex
+	idle   []*respConn
+	size   int
+	closed bool
+}
+
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// respError is an error reply sent by the server. It leaves the connection
+// usable, unlike transport errors.
+type respError string
+
+func (e respError) Error() string {
+	return "resp: " + string(e)
+}
+
+func NewRESPStore(cfg config.RESPConfig) *RESPStore {
+	s := &RESPStore{
+		addr:        cfg.Addr,
+		password:    cfg.Password,
+		db:          cfg.DB,
+		dialTimeout: cfg.DialTimeout,
+		timeout:     cfg.Timeout,
+		size:        cfg.PoolSize,
+	}
+	if s.dialTimeout <= 0 {
+		s.dialTimeout = defaultRESPDialTimeout
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultRESPTimeout
+	}
+	if s.size <= 0 {
+		s.size = defaultRESPPoolSize
+	}
+	s.slots = make(chan struct{}, s.size)
+	return s
+}
+
+func (s *RESPStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := s.do(ctx, "GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, errors.Errorf("resp: unexpected GET reply %T", reply)
+	}
+	return value, true, nil
+}
+
+func (s *RESPStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	_, err := s.do(ctx, "SET", key, value, "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+func (s *RESPStore) Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	reply, err := s.do(ctx, "SET", key, value, "PX", strconv.FormatInt(ms, 10), "NX")
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+func (s *RESPStore) Delete(ctx context.Context, key string) error {
+	_, err := s.do(ctx, "DEL", key)
+	return err
+}
+
+// DeletePrefix removes every key starting with prefix. It walks the keyspace
+// with SCAN so the server is never blocked by a single large command.
+func (s *RESPStore) DeletePrefix(ctx context.Context, prefix string) error {
+	return s.scan(ctx, prefix, func(keys []any) (bool, error) {
+		args := make([]any, 0, len(keys)+1)
+		args = append(args, "DEL")
+		args = append(args, keys...)
+		_, err := s.do(ctx, args...)
+		return true, err
+	})
+}
+
+func (s *RESPStore) Range(ctx context.Context, prefix string, fn func(key string, value []byte) bool) error {
+	return s.scan(ctx, prefix, func(keys []any) (bool, error) {
+		args := make([]any, 0, len(keys)+1)
+		args = append(args, "MGET")
+		args = append(args, keys...)
+		reply, err := s.do(ctx, args...)
+		if err != nil {
+			return false, err
+		}
+		values, ok := reply.([]any)
+		if !ok || len(values) != len(keys) {
+			return false, errors.Errorf("resp: unexpected MGET reply %T", reply)
+		}
+		for i, v := range values {
+			value, ok := v.([]byte)
+			if !ok {
+				continue
+			}
+			key, _ := keys[i].([]byte)
+			if !fn(string(key), value) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+// scan pages through keys starting with prefix, handing each non-empty page
+// to fn until fn returns false or the keyspace is exhausted.
+func (s *RESPStore) scan(ctx context.Context, prefix string, fn func(keys []any) (bool, error)) error {
+	pattern := globEscaper.Replace(prefix) + "*"
+	cursor := "0"
+	for {
+		reply, err := s.do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", respScanCount)
+		if err != nil {
+			return err
+		}
+		page, ok := reply.([]any)
+		if !ok || len(page) != 2 {
+			return errors.Errorf("resp: unexpected SCAN reply %T", reply)
+		}
+		next, _ := page[0].([]byte)
+		keys, _ := page[1].([]any)
+
+		if len(keys) > 0 {
+			more, err := fn(keys)
+			if err != nil || !more {
+				return err
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// TTL returns the remaining lifetime of key. A key without expiry reports a
+// zero TTL.
+func (s *RESPStore) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	reply, err := s.do(ctx, "PTTL", key)
+	if err != nil {
+		return 0, false, err
+	}
+	ms, ok := reply.(int64)
+	if !ok {
+		return 0, false, errors.Errorf("resp: unexpected PTTL reply %T", reply)
+	}
+	switch {
+	case ms == -2:
+		return 0, false, nil
+	case ms < 0:
+		return 0, true, nil
+	default:
+		return time.Duration(ms) * time.Millisecond, true, nil
+	}
+}
+
+func (s *RESPStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for _, c := range s.idle {
+		_ = c.conn.Close()
+	}
+	s.idle = nil
+	return nil
+}
+
+func (s *RESPStore) do(ctx context.Context, args ...any) (any, error) {
+	c, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		s.discard(c.conn)
+		return nil, errors.Wrap(err, "resp: set deadline")
+	}
+
+	reply, err := c.roundTrip(args...)
+	var replyErr respError
+	if err != nil && !errors.As(err, &replyErr) {
+		s.discard(c.conn)
+		return nil, err
+	}
+	s.release(c)
+	return reply, err
+}
+
+// acquire returns an idle connection or dials a new one, waiting until ctx is
+// done while all pool size connections are in use.
+func (s *RESPStore) acquire(ctx context.Context) (*respConn, error) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "resp: wait for connection")
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		<-s.slots
+		return nil, errors.New("resp: store closed")
+	}
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+
+	// Connections are only dialed when none is idle, so the ones open never
+	// outnumber the slots.
+	c, err := s.dial(ctx)
+	if err != nil {
+		<-s.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *RESPStore) release(c *respConn) {
+	s.mu.Lock()
+	if s.closed {
+		_ = c.conn.Close()
+	} else {
+		s.idle = append(s.idle, c)
+	}
+	s.mu.Unlock()
+	<-s.slots
+}
+
+// discard closes a connection that is no longer usable and frees its slot.
+func (s *RESPStore) discard(conn net.Conn) {
+	_ = conn.Close()
+	<-s.slots
+}
+
+func (s *RESPStore) dial(ctx context.Context) (*respConn, error) {
+	dialer := net.Dialer{Timeout: s.dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resp: dial %s", s.addr)
+	}
+	c := &respConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "resp: set deadline")
+	}
+	if s.password != "" {
+		if _, err := c.roundTrip("AUTH", s.password); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrap(err, "resp: auth")
+		}
+	}
+	if s.db != 0 {
+		if _, err := c.roundTrip("SELECT", strconv.Itoa(s.db)); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrap(err, "resp: select db")
+		}
+	}
+	return c, nil
+}
+
+func (c *respConn) roundTrip(args ...any) (any, error) {
+	if err := writeCommand(c.w, args...); err != nil {
+		return nil, errors.Wrap(err, "resp: write command")
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, errors.Wrap(err, "resp: flush command")
+	}
+	return readReply(c.r)
+}
+
+// writeCommand encodes args as a RESP array of bulk strings. Arguments must be
+// string or []byte.
+func writeCommand(w *bufio.Writer, args ...any) error {
+	if err := writeHeader(w, '*', len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		var b []byte
+		switch v := arg.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		default:
+			return errors.Errorf("unsupported argument type %T", arg)
+		}
+		if err := writeHeader(w, '$', len(b)); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeHeader(w *bufio.Writer, prefix byte, n int) error {
+	if err := w.WriteByte(prefix); err != nil {
+		return err
+	}
+	if _, err := w.WriteString(strconv.Itoa(n)); err != nil {
+		return err
+	}
+	_, err := w.WriteString("\r\n")
+	return err
+}
+
+// readReply decodes one RESP2 reply. Simple strings decode to string, integers
+// to int64, bulk strings to []byte, arrays to []any and null values to nil.
+// Error replies are returned as respError.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("resp: empty reply line")
+	}
+
+	payload := string(line[1:])
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, respError(payload)
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "resp: malformed integer")
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "resp: malformed bulk length")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, errors.Wrap(err, "resp: read bulk string")
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, errors.Wrap(err, "resp: malformed array length")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			item, err := readReply(r)
+			var replyErr respError
+			if errors.As(err, &replyErr) {
+				items[i] = replyErr
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, errors.Errorf("resp: unknown reply type %q", line[0])
+	}
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "resp: read reply")
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("resp: malformed reply line")
+	}
+	return line[:len(line)-2], nil
+}
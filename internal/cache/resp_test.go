@@ -0,0 +1,357 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"app/config"
+	"app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// respStandIn is a minimal in-process server speaking enough of the Redis
+// protocol for RESPStore: AUTH, SELECT, GET, MGET, SET [PX [NX]], DEL, PTTL and a
+// single-page SCAN.
+type respStandIn struct {
+	ln       net.Listener
+	password string
+
+	mu      sync.Mutex
+	data    map[string][]byte
+	expires map[string]time.Time
+}
+
+func newRESPStandIn(t *testing.T, password string) *respStandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &respStandIn{
+		ln:       ln,
+		password: password,
+		data:     make(map[string][]byte),
+		expires:  make(map[string]time.Time),
+	}
+	go s.serve()
+	t.Cleanup(func() { _ = ln.Close() })
+	return s
+}
+
+func (s *respStandIn) addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *respStandIn) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *respStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authed := s.password == ""
+
+	for {
+		req, err := readReply(r)
+		if err != nil {
+			return
+		}
+		items, _ := req.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			b, _ := item.([]byte)
+			args[i] = string(b)
+		}
+		if len(args) == 0 {
+			_, _ = w.WriteString("-ERR empty command\r\n")
+			_ = w.Flush()
+			continue
+		}
+
+		cmd := strings.ToUpper(args[0])
+		switch {
+		case cmd == "AUTH":
+			if len(args) == 2 && args[1] == s.password {
+				authed = true
+				_, _ = w.WriteString("+OK\r\n")
+			} else {
+				_, _ = w.WriteString("-WRONGPASS invalid password\r\n")
+			}
+		case !authed:
+			_, _ = w.WriteString("-NOAUTH Authentication required.\r\n")
+		default:
+			s.exec(w, cmd, args[1:])
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *respStandIn) exec(w *bufio.Writer, cmd string, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, at := range s.expires {
+		if time.Now().After(at) {
+			delete(s.data, key)
+			delete(s.expires, key)
+		}
+	}
+
+	switch cmd {
+	case "SELECT":
+		_, _ = w.WriteString("+OK\r\n")
+	case "GET":
+		v, ok := s.data[args[0]]
+		if !ok {
+			_, _ = w.WriteString("$-1\r\n")
+			return
+		}
+		_, _ = w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + string(v) + "\r\n")
+	case "MGET":
+		_, _ = w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+		for _, key := range args {
+			v, ok := s.data[key]
+			if !ok {
+				_, _ = w.WriteString("$-1\r\n")
+				continue
+			}
+			_, _ = w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + string(v) + "\r\n")
+		}
+	case "SET":
+		if len(args) == 5 && strings.EqualFold(args[4], "NX") && s.data[args[0]] != nil {
+			_, _ = w.WriteString("$-1\r\n")
+			return
+		}
+		s.data[args[0]] = []byte(args[1])
+		delete(s.expires, args[0])
+		if len(args) >= 4 && strings.EqualFold(args[2], "PX") {
+			ms, _ := strconv.Atoi(args[3])
+			s.expires[args[0]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		_, _ = w.WriteString("+OK\r\n")
+	case "DEL":
+		n := 0
+		for _, key := range args {
+			if _, ok := s.data[key]; ok {
+				n++
+			}
+			delete(s.data, key)
+			delete(s.expires, key)
+		}
+		_, _ = w.WriteString(":" + strconv.Itoa(n) + "\r\n")
+	case "PTTL":
+		switch at, ok := s.expires[args[0]]; {
+		case ok:
+			_, _ = w.WriteString(":" + strconv.FormatInt(time.Until(at).Milliseconds(), 10) + "\r\n")
+		case s.data[args[0]] != nil:
+			_, _ = w.WriteString(":-1\r\n")
+		default:
+			_, _ = w.WriteString(":-2\r\n")
+		}
+	case "SCAN":
+		var keys []string
+		for key := range s.data {
+			if ok, _ := path.Match(args[2], key); ok {
+				keys = append(keys, key)
+			}
+		}
+		_, _ = w.WriteString("*2\r\n$1\r\n0\r\n*" + strconv.Itoa(len(keys)) + "\r\n")
+		for _, key := range keys {
+			_, _ = w.WriteString("$" + strconv.Itoa(len(key)) + "\r\n" + key + "\r\n")
+		}
+	default:
+		_, _ = w.WriteString("-ERR unknown command '" + cmd + "'\r\n")
+	}
+}
+
+func TestRESPStore_RoundTrip(t *testing.T) {
+	server := newRESPStandIn(t, "secret")
+	store := NewRESPStore(config.RESPConfig{Addr: server.addr(), Password: "secret", DB: 1})
+	defer store.Close()
+	ctx := context.Background()
+
+	_, ok, err := store.Get(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.Set(ctx, "k", []byte("v\r\nwith crlf"), time.Minute))
+
+	v, ok, err := store.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v\r\nwith crlf"), v)
+
+	ttl, ok, err := store.TTL(ctx, "k")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+
+	require.NoError(t, store.Delete(ctx, "k"))
+	_, ok, err = store.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = store.TTL(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRESPStore_DeletePrefix(t *testing.T) {
+	server := newRESPStandIn(t, "")
+	store := NewRESPStore(config.RESPConfig{Addr: server.addr()})
+	defer store.Close()
+	ctx := context.Background()
+
+	require.NoError(t, store.Set(ctx, "user:1", []byte("a"), time.Minute))
+	require.NoError(t, store.Set(ctx, "user:2", []byte("b"), time.Minute))
+	require.NoError(t, store.Set(ctx, "user*x", []byte("c"), time.Minute))
+	require.NoError(t, store.Set(ctx, "other:1", []byte("d"), time.Minute))
+
+	require.NoError(t, store.DeletePrefix(ctx, "user:"))
+
+	for key, want := range map[string]bool{"user:1": false, "user:2": false, "user*x": true, "other:1": true} {
+		_, ok, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, want, ok, key)
+	}
+}
+
+func TestRESPStore_Range(t *testing.T) {
+	server := newRESPStandIn(t, "")
+	store := NewRESPStore(config.RESPConfig{Addr: server.addr()})
+	defer store.Close()
+	ctx := context.Background()
+
+	require.NoError(t, store.Set(ctx, "user:1", []byte("a"), time.Minute))
+	require.NoError(t, store.Set(ctx, "user:2", []byte("b"), time.Minute))
+	require.NoError(t, store.Set(ctx, "other:1", []byte("c"), time.Minute))
+
+	seen := map[string]string{}
+	require.NoError(t, store.Range(ctx, "user:", func(key string, value []byte) bool {
+		seen[key] = string(value)
+		return true
+	}))
+	assert.Equal(t, map[string]string{"user:1": "a", "user:2": "b"}, seen)
+}
+
+func TestRESPStore_Expiry(t *testing.T) {
+	server := newRESPStandIn(t, "")
+	store := NewRESPStore(config.RESPConfig{Addr: server.addr()})
+	defer store.Close()
+	ctx := context.Background()
+
+	require.NoError(t, store.Set(ctx, "k", []byte("v"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok, err := store.Get(ctx, "k")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRESPStore_AuthFailure(t *testing.T) {
+	server := newRESPStandIn(t, "secret")
+	store := NewRESPStore(config.RESPConfig{Addr: server.addr(), Password: "wrong"})
+	defer store.Close()
+
+	_, _, err := store.Get(context.Background(), "k")
+	assert.ErrorContains(t, err, "WRONGPASS")
+}
+
+func TestRESPStore_ErrorReplyKeepsConnection(t *testing.T) {
+	server := newRESPStandIn(t, "")
+	store := NewRESPStore(config.RESPConfig{Addr: server.addr()})
+	defer store.Close()
+	ctx := context.Background()
+
+	_, err := store.do(ctx, "NOPE")
+	var replyErr respError
+	require.ErrorAs(t, err, &replyErr)
+	assert.Len(t, store.idle, 1)
+
+	require.NoError(t, store.Set(ctx, "k", []byte("v"), time.Minute))
+	assert.Len(t, store.idle, 1)
+}
+
+func TestRESPStore_PoolBoundsOpenConnections(t *testing.T) {
+	server := newRESPStandIn(t, "")
+	store := NewRESPStore(config.RESPConfig{Addr: server.addr(), PoolSize: 1})
+	defer store.Close()
+
+	held, err := store.acquire(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, err = store.Get(ctx, "k")
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "a caller must wait for the only connection")
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := store.Get(context.Background(), "k")
+		done <- err
+	}()
+	store.release(held)
+	require.NoError(t, <-done)
+	assert.Len(t, store.idle, 1, "the released connection is reused")
+}
+
+func TestDecorator_RESPStore_SharedBetweenReplicas(t *testing.T) {
+	server := newRESPStandIn(t, "")
+	mockRepo := new(MockUserProvider)
+	first := NewDecorator(mockRepo, 10*time.Minute, WithStore(NewRESPStore(config.RESPConfig{Addr: server.addr()})))
+	second := NewDecorator(mockRepo, 10*time.Minute, WithStore(NewRESPStore(config.RESPConfig{Addr: server.addr()})))
+
+	testUser := &models.User{ID: "123", Name: "Test User", Age: 30}
+	mockRepo.On("Get", mock.Anything, "123").Return(testUser, nil).Once()
+
+	user, err := first.Get(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, testUser, user)
+
+	user, err = second.Get(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, testUser, user)
+	mockRepo.AssertNumberOfCalls(t, "Get", 1)
+
+	mockRepo.On("Delete", mock.Anything, "123").Return(nil).Once()
+	require.NoError(t, first.Delete(context.Background(), "123"))
+
+	_, ok := second.get(context.Background(), "123")
+	assert.False(t, ok)
+}
+
+func TestDecorator_RESPStore_Unavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, 10*time.Minute, WithStore(NewRESPStore(config.RESPConfig{Addr: addr})))
+
+	testUser := &models.User{ID: "123", Name: "Test User", Age: 30}
+	mockRepo.On("Get", mock.Anything, "123").Return(testUser, nil).Once()
+
+	user, err := cache.Get(context.Background(), "123")
+	require.NoError(t, err)
+	assert.Equal(t, testUser, user)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"app/internal/models"
+	"app/internal/tracing"
+
+	"github.com/pkg/errors"
+)
+
+// snapshotEntry is one line of a snapshot: a store key, the entry stored
+// under it and when its store TTL runs out.
+type snapshotEntry struct {
+	Key       string          `json:"key"`
+	Entry     json.RawMessage `json:"entry"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// Snapshot writes every live entry of this entity to w as JSON lines and
+// returns how many it wrote.
+func (e *Entity[K, V]) Snapshot(ctx context.Context, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	n := 0
+	var writeErr error
+	err := e.store.Range(ctx, e.prefix, func(key string, data []byte) bool {
+		ttl, ok, err := e.store.TTL(ctx, key)
+		if err != nil {
+			writeErr = err
+			return false
+		}
+		if !ok || ttl <= 0 {
+			return true
+		}
+		line := snapshotEntry{Key: key, Entry: data, ExpiresAt: time.Now().Add(ttl)}
+		if err := enc.Encode(line); err != nil {
+			writeErr = errors.Wrap(err, "write snapshot entry")
+			return false
+		}
+		n++
+		return true
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return n, errors.Wrapf(err, "snapshot %s cache", e.cfg.Name)
+	}
+	return n, nil
+}
+
+// Restore loads entries written by Snapshot, each with the TTL it had left.
+// Entries that have expired since, or that belong to another entity, are
+// skipped. A non-nil stale is given the remaining values by formatted key,
+// with the zero V for not-found entries, and returns the keys that no longer
+// match the repository; those are skipped too. It returns how many entries
+// were restored.
+func (e *Entity[K, V]) Restore(ctx context.Context, r io.Reader, stale func(ctx context.Context, values map[string]V) (map[string]bool, error)) (int, error) {
+	dec := json.NewDecoder(r)
+	var lines []snapshotEntry
+	values := make(map[string]V)
+	for {
+		var line snapshotEntry
+		if err := dec.Decode(&line); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, errors.Wrapf(err, "decode %s snapshot", e.cfg.Name)
+		}
+		if !strings.HasPrefix(line.Key, e.prefix) || time.Until(line.ExpiresAt) <= 0 {
+			continue
+		}
+		var entry entityEntry[V]
+		if err := json.Unmarshal(line.Entry, &entry); err != nil {
+			return 0, errors.Wrapf(err, "decode %s", line.Key)
+		}
+		lines = append(lines, line)
+		values[strings.TrimPrefix(line.Key, e.prefix)] = entry.Value
+	}
+
+	var skip map[string]bool
+	if stale != nil && len(values) > 0 {
+		var err error
+		if skip, err = stale(ctx, values); err != nil {
+			return 0, errors.Wrapf(err, "check %s snapshot", e.cfg.Name)
+		}
+	}
+
+	n := 0
+	for _, line := range lines {
+		if skip[strings.TrimPrefix(line.Key, e.prefix)] {
+			continue
+		}
+		// Recomputed, as the stale check may have taken a while.
+		ttl := time.Until(line.ExpiresAt)
+		if ttl <= 0 {
+			continue
+		}
+		if err := e.store.Set(ctx, line.Key, line.Entry, ttl); err != nil {
+			return n, errors.Wrapf(err, "restore %s", line.Key)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// RecentUsers lists the most recently updated users, most recent first.
+type RecentUsers interface {
+	RecentlyUpdated(ctx context.Context, limit int) ([]*models.User, error)
+}
+
+// WarmUp caches the n most recently updated users, as the likeliest to be
+// read right after a deploy. It returns how many users were cached.
+func (c *Decorator) WarmUp(ctx context.Context, src RecentUsers, n int) (int, error) {
+	ctx, span := tracing.Start(ctx, "Cache.WarmUpUsers")
+	defer span.End()
+
+	users, err := src.RecentlyUpdated(ctx, n)
+	if err != nil {
+		return 0, errors.Wrap(err, "list recently updated users")
+	}
+	for _, user := range users {
+		c.users.set(ctx, user)
+	}
+	return len(users), nil
+}
+
+// SaveSnapshot writes the cached users to path. The file is replaced
+// atomically, so a crash mid-write leaves the previous snapshot intact.
+func (c *Decorator) SaveSnapshot(ctx context.Context, path string) (int, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return 0, errors.Wrap(err, "create snapshot file")
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	n, err := c.users.Snapshot(ctx, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "write snapshot file")
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, errors.Wrap(err, "replace snapshot file")
+	}
+	return n, nil
+}
+
+// UserVersions reports the current version of each of ids that exists.
+type UserVersions interface {
+	Versions(ctx context.Context, ids []string) (map[string]int64, error)
+}
+
+// LoadSnapshot restores the cached users saved to path by SaveSnapshot. Users
+// written while no process was listening for changes are checked against the
+// versions in src, and those that changed, were deleted or were created since
+// are not restored. A missing file restores nothing.
+func (c *Decorator) LoadSnapshot(ctx context.Context, path string, src UserVersions) (int, error) {
+	ctx, span := tracing.Start(ctx, "Cache.LoadUserSnapshot")
+	defer span.End()
+
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "open snapshot file")
+	}
+	defer f.Close()
+
+	return c.users.Restore(ctx, bufio.NewReader(f), func(ctx context.Context, users map[string]*models.User) (map[string]bool, error) {
+		ids := make([]string, 0, len(users))
+		for id := range users {
+			ids = append(ids, id)
+		}
+		versions, err := src.Versions(ctx, ids)
+		if err != nil {
+			return nil, errors.Wrap(err, "read user versions")
+		}
+		stale := make(map[string]bool)
+		for id, user := range users {
+			version, exists := versions[id]
+			if (user == nil && exists) || (user != nil && (!exists || version != user.Version)) {
+				stale[id] = true
+			}
+		}
+		if len(stale) > 0 {
+			slog.Info("Cache: skipping snapshot users changed since it was saved", "users", len(stale))
+		}
+		return stale, nil
+	})
+}
@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"app/internal/apperr"
+	"app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRecentUsers struct {
+	users []*models.User
+	err   error
+	limit int
+}
+
+func (f *fakeRecentUsers) RecentlyUpdated(_ context.Context, limit int) ([]*models.User, error) {
+	f.limit = limit
+	if limit < len(f.users) {
+		return f.users[:limit], f.err
+	}
+	return f.users, f.err
+}
+
+type fakeUserVersions struct {
+	versions map[string]int64
+	err      error
+}
+
+func (f fakeUserVersions) Versions(_ context.Context, ids []string) (map[string]int64, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	versions := make(map[string]int64)
+	for _, id := range ids {
+		if v, ok := f.versions[id]; ok {
+			versions[id] = v
+		}
+	}
+	return versions, nil
+}
+
+func TestDecorator_Snapshot_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.snapshot")
+	mockRepo := new(MockUserProvider)
+
+	before := NewDecorator(mockRepo, time.Minute, WithNegativeTTL(time.Minute))
+	before.set(ctx, &models.User{ID: "1", Name: "Alice", Age: 30, Version: 1})
+	mockRepo.On("Get", mock.Anything, "2").Return(nil, apperr.ErrNotFound).Once()
+	_, err := before.Get(ctx, "2")
+	require.ErrorIs(t, err, apperr.ErrNotFound)
+	ttl, ok, err := before.store.TTL(ctx, "user:1")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	n, err := before.SaveSnapshot(ctx, path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	after := NewDecorator(mockRepo, time.Minute, WithNegativeTTL(time.Minute))
+	n, err = after.LoadSnapshot(ctx, path, fakeUserVersions{versions: map[string]int64{"1": 1}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	user, err := after.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", user.Name)
+	_, err = after.Get(ctx, "2")
+	require.ErrorIs(t, err, apperr.ErrNotFound, "not-found entries survive the restart too")
+	mockRepo.AssertExpectations(t)
+
+	restored, ok, err := after.store.TTL(ctx, "user:1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.LessOrEqual(t, restored, ttl, "restored entries keep their remaining TTL")
+	assert.InDelta(t, ttl, restored, float64(time.Second))
+}
+
+func TestEntity_Restore_SkipsExpiredAndForeignEntries(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(0, 0, PolicyLRU)
+	orders := newOrderEntity(newFakeOrderRepo(), store)
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"key":"order:1","entry":{"value":{"id":1}},"expires_at":"` + time.Now().Add(-time.Second).Format(time.RFC3339Nano) + `"}` + "\n")
+	buf.WriteString(`{"key":"user:1","entry":{"value":{"id":"1"}},"expires_at":"` + time.Now().Add(time.Hour).Format(time.RFC3339Nano) + `"}` + "\n")
+	buf.WriteString(`{"key":"order:2","entry":{"value":{"id":2}},"expires_at":"` + time.Now().Add(time.Hour).Format(time.RFC3339Nano) + `"}` + "\n")
+
+	n, err := orders.Restore(ctx, &buf, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, has(t, store, "order:1"))
+	assert.False(t, has(t, store, "user:1"))
+	assert.True(t, has(t, store, "order:2"))
+}
+
+func TestDecorator_LoadSnapshot_SkipsChangedUsers(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.snapshot")
+
+	before := NewDecorator(new(MockUserProvider), time.Minute, WithNegativeTTL(time.Minute))
+	before.set(ctx, &models.User{ID: "same", Version: 2})
+	before.set(ctx, &models.User{ID: "updated", Version: 1})
+	before.set(ctx, &models.User{ID: "deleted", Version: 1})
+	before.users.setNotFound(ctx, "created")
+	_, err := before.SaveSnapshot(ctx, path)
+	require.NoError(t, err)
+
+	after := NewDecorator(new(MockUserProvider), time.Minute, WithNegativeTTL(time.Minute))
+	n, err := after.LoadSnapshot(ctx, path, fakeUserVersions{versions: map[string]int64{
+		"same":    2,
+		"updated": 3,
+		"created": 1,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, has(t, after.store, "user:same"))
+	assert.False(t, has(t, after.store, "user:updated"))
+	assert.False(t, has(t, after.store, "user:deleted"))
+	assert.False(t, has(t, after.store, "user:created"))
+}
+
+func TestDecorator_LoadSnapshot_UncheckedSnapshotIsNotRestored(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.snapshot")
+
+	before := NewDecorator(new(MockUserProvider), time.Minute)
+	before.set(ctx, &models.User{ID: "1", Version: 1})
+	_, err := before.SaveSnapshot(ctx, path)
+	require.NoError(t, err)
+
+	after := NewDecorator(new(MockUserProvider), time.Minute)
+	_, err = after.LoadSnapshot(ctx, path, fakeUserVersions{err: errors.New("db down")})
+	require.Error(t, err)
+	assert.False(t, has(t, after.store, "user:1"))
+}
+
+func TestDecorator_LoadSnapshot_MissingFile(t *testing.T) {
+	cache := NewDecorator(new(MockUserProvider), time.Minute)
+
+	n, err := cache.LoadSnapshot(context.Background(), filepath.Join(t.TempDir(), "missing"), fakeUserVersions{})
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestDecorator_SaveSnapshot_KeepsPreviousOnFailure(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.snapshot")
+	require.NoError(t, os.WriteFile(path, []byte("previous"), 0o600))
+
+	cache := NewDecorator(new(MockUserProvider), time.Minute, WithStore(failingRangeStore{NewMemoryStore(0, 0, PolicyLRU)}))
+	_, err := cache.SaveSnapshot(ctx, path)
+	require.Error(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", string(data))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary file should be cleaned up")
+}
+
+type failingRangeStore struct {
+	*MemoryStore
+}
+
+func (failingRangeStore) Range(context.Context, string, func(string, []byte) bool) error {
+	return errors.New("range failed")
+}
+
+func TestDecorator_WarmUp(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockUserProvider)
+	cache := NewDecorator(mockRepo, time.Minute)
+	src := &fakeRecentUsers{users: []*models.User{
+		{ID: "1", Name: "Alice"},
+		{ID: "2", Name: "Bob"},
+		{ID: "3", Name: "Carol"},
+	}}
+
+	n, err := cache.WarmUp(ctx, src, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 2, src.limit)
+
+	user, err := cache.Get(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, "Bob", user.Name)
+	_, ok := cache.get(ctx, "3")
+	assert.False(t, ok)
+	mockRepo.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+}
+
+func TestDecorator_WarmUp_SourceError(t *testing.T) {
+	cache := NewDecorator(new(MockUserProvider), time.Minute)
+
+	_, err := cache.WarmUp(context.Background(), &fakeRecentUsers{err: errors.New("db down")}, 10)
+	assert.Error(t, err)
+}
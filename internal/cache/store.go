@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"app/config"
+
+	"github.com/pkg/errors"
+)
+
+// Backend names accepted by config.CacheConfig.Backend.
+const (
+	BackendMemory = "memory"
+	BackendRESP   = "resp"
+)
+
+// Store is the storage behind the caching decorators. Get reports a miss with
+// ok=false and a nil error; errors are reserved for backend failures.
+type Store interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Add is Set for a key that holds no live value, and reports whether it
+	// stored value. The check and the write are atomic.
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Delete(ctx context.Context, key string) error
+	DeletePrefix(ctx context.Context, prefix string) error
+	TTL(ctx context.Context, key string) (ttl time.Duration, ok bool, err error)
+	// Range calls fn for every live key starting with prefix until fn returns
+	// false. It is meant for administrative scans, not the request path.
+	Range(ctx context.Context, prefix string, fn func(key string, value []byte) bool) error
+}
+
+// NewStore builds the Store selected by cfg.Backend.
+func NewStore(cfg config.CacheConfig) (Store, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case "", BackendMemory:
+		policy, err := ParsePolicy(cfg.EvictionPolicy)
+		if err != nil {
+			return nil, err
+		}
+		return NewShardedMemoryStore(cfg.Shards, cfg.MaxEntries, cfg.MaxBytes, policy), nil
+	case BackendRESP:
+		if cfg.RESP.Addr == "" {
+			return nil, errors.New("resp cache backend requires an address")
+		}
+		return NewRESPStore(cfg.RESP), nil
+	default:
+		return nil, errors.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
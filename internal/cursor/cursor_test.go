@@ -0,0 +1,58 @@
+package cursor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type position struct {
+	ID   string `json:"id"`
+	Name string `json:"n"`
+}
+
+func TestSigner_RoundTrip(t *testing.T) {
+	s := NewSigner("secret")
+
+	token, err := s.Encode(position{ID: "1", Name: "Alice"})
+	require.NoError(t, err)
+
+	var got position
+	require.NoError(t, s.Decode(token, &got))
+	assert.Equal(t, position{ID: "1", Name: "Alice"}, got)
+}
+
+func TestSigner_RejectsTampering(t *testing.T) {
+	s := NewSigner("secret")
+	token, err := s.Encode(position{ID: "1"})
+	require.NoError(t, err)
+
+	forged, err := NewSigner("other").Encode(position{ID: "2"})
+	require.NoError(t, err)
+	payload, _, _ := strings.Cut(forged, ".")
+	_, sig, _ := strings.Cut(token, ".")
+
+	for name, bad := range map[string]string{
+		"empty":         "",
+		"no signature":  payload,
+		"swapped":       payload + "." + sig,
+		"other key":     forged,
+		"not base64":    "!!!." + sig,
+		"truncated sig": token[:len(token)-2],
+	} {
+		t.Run(name, func(t *testing.T) {
+			var got position
+			assert.ErrorIs(t, s.Decode(bad, &got), ErrInvalid)
+		})
+	}
+}
+
+func TestSigner_RandomKeysDiffer(t *testing.T) {
+	token, err := NewSigner("").Encode(position{ID: "1"})
+	require.NoError(t, err)
+
+	var got position
+	assert.ErrorIs(t, NewSigner("").Decode(token, &got), ErrInvalid)
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+
+	"app/internal/apperr"
+	"app/internal/cache"
+	"app/internal/models"
+	"app/internal/tracing"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type CacheAdminHandler interface {
+	CacheStats(ctx *fiber.Ctx) error
+	InspectCachedUser(ctx *fiber.Ctx) error
+	PurgeCachedUser(ctx *fiber.Ctx) error
+	PurgeCache(ctx *fiber.Ctx) error
+}
+
+type CacheAdmin interface {
+	Stats(ctx context.Context) (cache.Stats, error)
+	Inspect(ctx context.Context, id string) (cache.EntryInfo[*models.User], bool, error)
+	Purge(ctx context.Context, id string)
+	PurgeAll(ctx context.Context) error
+}
+
+type AdminHandler struct {
+	cache CacheAdmin
+}
+
+func NewAdminHandler(c CacheAdmin) *AdminHandler {
+	return &AdminHandler{
+		cache: c,
+	}
+}
+
+func (h *AdminHandler) CacheStats(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.CacheStats")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	stats, err := h.cache.Stats(ctx.UserContext())
+	if err != nil {
+		slog.Error("CacheStats: Failed to collect cache stats", "error", err)
+		return err
+	}
+
+	return ctx.JSON(stats)
+}
+
+func (h *AdminHandler) InspectCachedUser(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.InspectCachedUser")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	id := ctx.Params("id")
+	if _, err := uuid.Parse(id); err != nil {
+		slog.Info("InspectCachedUser: Invalid UUID", "id", id, "error", err)
+		return apperr.Validation("Invalid UUID")
+	}
+
+	info, ok, err := h.cache.Inspect(ctx.UserContext(), id)
+	if err != nil {
+		slog.Error("InspectCachedUser: Failed to read cache", "id", id, "error", err)
+		return err
+	}
+	if !ok {
+		return apperr.NotFound("User not cached")
+	}
+
+	var user *models.UserResponse
+	if info.Value != nil {
+		resp := info.Value.ToResponse()
+		user = &resp
+	}
+	return ctx.JSON(fiber.Map{
+		"id":         id,
+		"user":       user,
+		"not_found":  info.NotFound,
+		"stale":      info.Stale,
+		"stored_at":  info.StoredAt,
+		"fresh_till": info.FreshTill,
+		"expires_at": info.ExpiresAt,
+	})
+}
+
+func (h *AdminHandler) PurgeCachedUser(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.PurgeCachedUser")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	id := ctx.Params("id")
+	if _, err := uuid.Parse(id); err != nil {
+		slog.Info("PurgeCachedUser: Invalid UUID", "id", id, "error", err)
+		return apperr.Validation("Invalid UUID")
+	}
+
+	h.cache.Purge(ctx.UserContext(), id)
+
+	slog.Info("PurgeCachedUser: User purged from cache", "id", id)
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AdminHandler) PurgeCache(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.PurgeCache")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	if err := h.cache.PurgeAll(ctx.UserContext()); err != nil {
+		slog.Error("PurgeCache: Failed to purge cache", "error", err)
+		return err
+	}
+
+	slog.Info("PurgeCache: Cache purged")
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
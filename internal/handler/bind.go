@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+
+	"app/internal/apperr"
+	"app/internal/models"
+
+	validator "github.com/go-playground/validator/v10"
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+// bind parses the request body into a T and validates it. Either failure is
+// a validation error; a failed validation lists every invalid field.
+func bind[T any](ctx *fiber.Ctx) (*T, error) {
+	req := new(T)
+	if err := ctx.BodyParser(req); err != nil {
+		return nil, apperr.Validation("Invalid input").WithCause(err)
+	}
+	if err := models.Validate(req); err != nil {
+		return nil, validationError(ctx, err)
+	}
+	return req, nil
+}
+
+// validationError turns the errors of models.Validate into a validation
+// error listing fieldErrors.
+func validationError(ctx *fiber.Ctx, err error) error {
+	fields := fieldErrors(ctx, err)
+	if fields == nil {
+		return apperr.Validation("Invalid input").WithCause(err)
+	}
+	return apperr.Validation("Invalid input", fields...)
+}
+
+// fieldErrors describes the errors of models.Validate with one FieldError per
+// failed rule, its message in the language the client accepts. A JSON
+// decoding error is described by the member it failed on, when it names
+// one. Other errors have no fields.
+func fieldErrors(ctx *fiber.Ctx, err error) []apperr.FieldError {
+	trans := models.Translator(ctx.AcceptsLanguages(models.Languages...))
+	if field, rule, ok := decodeFailure(err); ok {
+		msg, _ := trans.T(rule, field)
+		return []apperr.FieldError{{Field: field, Rule: rule, Message: msg}}
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+	fields := make([]apperr.FieldError, len(verrs))
+	for i, fe := range verrs {
+		fields[i] = apperr.FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fe.Translate(trans),
+		}
+	}
+	return fields
+}
+
+// decodeFailure returns the member a json.Decoder error is about and the
+// rule it broke. encoding/json reports unknown fields with a plain error, so
+// those are recognised by their text.
+func decodeFailure(err error) (field, rule string, ok bool) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return typeErr.Field, models.RuleType, true
+	}
+	if err != nil {
+		if name, found := strings.CutPrefix(err.Error(), "json: unknown field "); found {
+			return strings.Trim(name, `"`), models.RuleUnknown, true
+		}
+	}
+	return "", "", false
+}
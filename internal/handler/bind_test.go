@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postBind(t *testing.T, body, lang string) (int, Problem) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if lang != "" {
+		req.Header.Set(fiber.HeaderAcceptLanguage, lang)
+	}
+	resp := serve(t, "/", func(ctx *fiber.Ctx) error {
+		req, err := bind[models.CreateUserRequest](ctx)
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(req)
+	}, req)
+
+	var p Problem
+	if resp.StatusCode != fiber.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&p))
+	}
+	return resp.StatusCode, p
+}
+
+func TestBind(t *testing.T) {
+	status, _ := postBind(t, `{"name":"Ann","age":0}`, "")
+	assert.Equal(t, fiber.StatusOK, status)
+
+	status, p := postBind(t, `{"name":"","age":151}`, "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	require.Len(t, p.Errors, 2)
+	assert.Equal(t, "name", p.Errors[0].Field)
+	assert.Equal(t, "required", p.Errors[0].Rule)
+	assert.Equal(t, "name is a required field", p.Errors[0].Message)
+	assert.Equal(t, "age", p.Errors[1].Field)
+	assert.Equal(t, "lte", p.Errors[1].Rule)
+	assert.Equal(t, "age must be 150 or less", p.Errors[1].Message)
+
+	status, _ = postBind(t, `{"name":`, "")
+	assert.Equal(t, fiber.StatusBadRequest, status)
+}
+
+func TestBind_Language(t *testing.T) {
+	_, p := postBind(t, `{"age":20}`, "ru-RU,ru;q=0.9,en;q=0.8")
+	require.Len(t, p.Errors, 1)
+	assert.Equal(t, "name обязательное поле", p.Errors[0].Message)
+
+	_, p = postBind(t, `{"age":20}`, "de")
+	require.Len(t, p.Errors, 1)
+	assert.Equal(t, "name is a required field", p.Errors[0].Message)
+}
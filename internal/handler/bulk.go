@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"log/slog"
+
+	"app/internal/apperr"
+	"app/internal/models"
+	"app/internal/tracing"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// maxBulkItems caps the number of items in one bulk request.
+const maxBulkItems = 10000
+
+// Per-item statuses reported by the bulk endpoints.
+const (
+	bulkOK       = "ok"
+	bulkInvalid  = "invalid"
+	bulkNotFound = "not_found"
+	bulkAborted  = "aborted"
+	bulkFailed   = "failed"
+)
+
+type bulkItemResponse struct {
+	Index  int                 `json:"index"`
+	ID     string              `json:"id,omitempty"`
+	Status string              `json:"status"`
+	Error  string              `json:"error,omitempty"`
+	Errors []apperr.FieldError `json:"errors,omitempty"`
+}
+
+// CreateUsers creates the users in a JSON array. With mode=atomic (the
+// default) either all of them are created or none; with mode=best_effort
+// every valid user is created. Each item's outcome is reported by index.
+func (h *Handler) CreateUsers(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.CreateUsers")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	mode, err := models.ParseBulkMode(ctx.Query("mode"))
+	if err != nil {
+		slog.Info("CreateUsers: Invalid mode", "mode", ctx.Query("mode"))
+		return apperr.Validation("Invalid mode")
+	}
+	var reqs []models.CreateUserRequest
+	if err := ctx.BodyParser(&reqs); err != nil || len(reqs) == 0 || len(reqs) > maxBulkItems {
+		slog.Info("CreateUsers: Invalid input", "count", len(reqs), "error", err)
+		return apperr.Validation("Invalid input")
+	}
+
+	users := make([]*models.User, len(reqs))
+	invalid := make([]error, len(reqs))
+	for i := range reqs {
+		user := models.ToEntityFromCreate(reqs[i])
+		users[i] = &user
+		if err := reqs[i].Validate(); err != nil {
+			invalid[i] = validationError(ctx, err)
+		}
+	}
+
+	return bulkRespond(ctx, "CreateUsers", mode, invalid, fiber.StatusCreated, func(idx []int) ([]models.BulkResult, error) {
+		return h.userUC.CreateUsers(ctx.UserContext(), pick(users, idx), mode)
+	})
+}
+
+// UpdateUsers replaces the users in a JSON array, in the same modes as
+// CreateUsers. Unknown ids are reported as not_found.
+func (h *Handler) UpdateUsers(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.UpdateUsers")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	mode, err := models.ParseBulkMode(ctx.Query("mode"))
+	if err != nil {
+		slog.Info("UpdateUsers: Invalid mode", "mode", ctx.Query("mode"))
+		return apperr.Validation("Invalid mode")
+	}
+	var reqs []models.UpdateUserRequest
+	if err := ctx.BodyParser(&reqs); err != nil || len(reqs) == 0 || len(reqs) > maxBulkItems {
+		slog.Info("UpdateUsers: Invalid input", "count", len(reqs), "error", err)
+		return apperr.Validation("Invalid input")
+	}
+
+	users := make([]*models.User, len(reqs))
+	invalid := make([]error, len(reqs))
+	for i := range reqs {
+		user := models.ToEntityFromUpdate(reqs[i])
+		users[i] = &user
+		if err := reqs[i].Validate(); err != nil {
+			invalid[i] = validationError(ctx, err)
+		}
+	}
+
+	return bulkRespond(ctx, "UpdateUsers", mode, invalid, fiber.StatusOK, func(idx []int) ([]models.BulkResult, error) {
+		return h.userUC.UpdateUsers(ctx.UserContext(), pick(users, idx), mode)
+	})
+}
+
+// DeleteUsers deletes the users whose ids are given as a JSON array, in the
+// same modes as CreateUsers.
+func (h *Handler) DeleteUsers(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.DeleteUsers")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	mode, err := models.ParseBulkMode(ctx.Query("mode"))
+	if err != nil {
+		slog.Info("DeleteUsers: Invalid mode", "mode", ctx.Query("mode"))
+		return apperr.Validation("Invalid mode")
+	}
+	var ids []string
+	if err := ctx.BodyParser(&ids); err != nil || len(ids) == 0 || len(ids) > maxBulkItems {
+		slog.Info("DeleteUsers: Invalid input", "count", len(ids), "error", err)
+		return apperr.Validation("Invalid input")
+	}
+
+	invalid := make([]error, len(ids))
+	for i, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			invalid[i] = apperr.Validation("Invalid UUID")
+		}
+	}
+
+	return bulkRespond(ctx, "DeleteUsers", mode, invalid, fiber.StatusOK, func(idx []int) ([]models.BulkResult, error) {
+		return h.userUC.DeleteUsers(ctx.UserContext(), pick(ids, idx), mode)
+	})
+}
+
+func pick[T any](items []T, idx []int) []T {
+	res := make([]T, len(idx))
+	for k, i := range idx {
+		res[k] = items[i]
+	}
+	return res
+}
+
+// bulkRespond writes the valid items with write and reports every item; an
+// item is invalid when it has a validation error in invalid, which is
+// reported with it. In atomic mode an invalid item fails the request before
+// anything is written.
+// The status is success when every item was applied, 207 when best effort
+// applied only some and 422 when an atomic request was not applied.
+func bulkRespond(ctx *fiber.Ctx, op string, mode models.BulkMode, invalid []error, success int, write func(idx []int) ([]models.BulkResult, error)) error {
+	items := make([]bulkItemResponse, len(invalid))
+	idx := make([]int, 0, len(invalid))
+	for i, err := range invalid {
+		items[i].Index = i
+		if err == nil {
+			idx = append(idx, i)
+			continue
+		}
+		items[i].Status, items[i].Error = bulkInvalid, "Invalid input"
+		var appErr *apperr.Error
+		if errors.As(err, &appErr) {
+			items[i].Error, items[i].Errors = appErr.Detail, appErr.Fields
+		}
+	}
+
+	if mode == models.BulkAtomic && len(idx) < len(invalid) {
+		for _, i := range idx {
+			items[i].Status, items[i].Error = bulkAborted, "Not applied: another item failed"
+		}
+		idx = idx[:0]
+	}
+	if len(idx) > 0 {
+		results, err := write(idx)
+		if err != nil {
+			slog.Info(op+": Failed to write users", "count", len(idx), "error", err)
+			return err
+		}
+		for k, res := range results {
+			if res.Err == nil {
+				items[idx[k]].ID = res.ID
+			}
+			items[idx[k]].Status, items[idx[k]].Error = bulkStatus(res.Err)
+		}
+	}
+
+	succeeded := 0
+	for _, item := range items {
+		if item.Status == bulkOK {
+			succeeded++
+		}
+	}
+	failed := len(items) - succeeded
+
+	status := success
+	switch {
+	case failed > 0 && mode == models.BulkAtomic:
+		status = fiber.StatusUnprocessableEntity
+	case failed > 0:
+		status = fiber.StatusMultiStatus
+	}
+	slog.Info(op+": Bulk request handled", "mode", mode, "succeeded", succeeded, "failed", failed)
+	return ctx.Status(status).JSON(fiber.Map{
+		"mode":      mode,
+		"succeeded": succeeded,
+		"failed":    failed,
+		"results":   items,
+	})
+}
+
+// bulkStatus maps an item error to its status and a message that is safe to
+// return to the client.
+func bulkStatus(err error) (string, string) {
+	switch {
+	case err == nil:
+		return bulkOK, ""
+	case errors.Is(err, apperr.ErrNotFound):
+		return bulkNotFound, "User not found"
+	case errors.Is(err, apperr.ErrAborted):
+		return bulkAborted, "Not applied: another item failed"
+	default:
+		return bulkFailed, "Failed to write user"
+	}
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app/internal/apperr"
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type bulkBody struct {
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []bulkItemResponse `json:"results"`
+}
+
+// serveBulk runs bulkRespond for items whose validation errors are given by
+// invalid and whose write outcomes are given by outcomes, indexed like
+// invalid.
+func serveBulk(t *testing.T, mode models.BulkMode, invalid []error, outcomes []error) (int, bulkBody, [][]int) {
+	t.Helper()
+	var writes [][]int
+	resp := serve(t, "/", func(ctx *fiber.Ctx) error {
+		return bulkRespond(ctx, "Test", mode, invalid, fiber.StatusCreated, func(idx []int) ([]models.BulkResult, error) {
+			writes = append(writes, idx)
+			results := make([]models.BulkResult, len(idx))
+			for k, i := range idx {
+				results[k] = models.BulkResult{ID: string(rune('a' + i)), Err: outcomes[i]}
+			}
+			return results, nil
+		})
+	}, httptest.NewRequest(fiber.MethodPost, "/", nil))
+
+	var body bulkBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body, writes
+}
+
+func TestBulkRespond_AllApplied(t *testing.T) {
+	status, body, _ := serveBulk(t, models.BulkAtomic, []error{nil, nil}, []error{nil, nil})
+
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, 2, body.Succeeded)
+	assert.Equal(t, bulkItemResponse{Index: 1, ID: "b", Status: bulkOK}, body.Results[1])
+}
+
+func TestBulkRespond_AtomicInvalidWritesNothing(t *testing.T) {
+	status, body, writes := serveBulk(t, models.BulkAtomic, []error{nil, apperr.Validation("Invalid UUID")}, nil)
+
+	assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+	assert.Empty(t, writes)
+	assert.Equal(t, bulkAborted, body.Results[0].Status)
+	assert.Equal(t, bulkItemResponse{Index: 1, Status: bulkInvalid, Error: "Invalid UUID"}, body.Results[1])
+}
+
+func TestBulkRespond_BestEffortPartial(t *testing.T) {
+	status, body, writes := serveBulk(t, models.BulkBestEffort,
+		[]error{nil, apperr.Validation("Invalid UUID"), nil}, []error{nil, nil, apperr.ErrNotFound})
+
+	assert.Equal(t, fiber.StatusMultiStatus, status)
+	assert.Equal(t, [][]int{{0, 2}}, writes, "invalid items are not written")
+	assert.Equal(t, 1, body.Succeeded)
+	assert.Equal(t, 2, body.Failed)
+	assert.Equal(t, bulkItemResponse{Index: 2, Status: bulkNotFound, Error: "User not found"}, body.Results[2])
+}
+
+func TestCreateUsers_InvalidItemsListFieldErrors(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("CreateUsers", mock.Anything, usersNamed("Ann"), models.BulkBestEffort).
+		Return([]models.BulkResult{{ID: "a"}}, nil).Once()
+
+	req := httptest.NewRequest(fiber.MethodPost, "/users?mode=best_effort",
+		strings.NewReader(`[{"name":"Ann","age":30},{"name":"Bob","age":151}]`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAcceptLanguage, "ru")
+	resp := serve(t, "/users", (&Handler{userUC: users}).CreateUsers, req)
+
+	assert.Equal(t, fiber.StatusMultiStatus, resp.StatusCode)
+	var body bulkBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, bulkItemResponse{
+		Index:  1,
+		Status: bulkInvalid,
+		Error:  "Invalid input",
+		Errors: []apperr.FieldError{{Field: "age", Rule: "lte", Message: "age должен быть менее или равен 150"}},
+	}, body.Results[1])
+	users.AssertExpectations(t)
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+// etag renders a user version as a strong entity tag.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatch returns the version a write is conditional on, zero when the
+// request has no If-Match, or models.AnyVersion for "*", which only needs
+// the user to exist. Only a single entity tag is supported.
+// Weak tags never match under the strong comparison If-Match requires, so
+// they come back as the impossible version -1.
+func ifMatch(ctx *fiber.Ctx) (int64, error) {
+	header := strings.TrimSpace(ctx.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		return 0, nil
+	}
+	if header == "*" {
+		return models.AnyVersion, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, errors.New("several entity tags")
+	}
+	if strings.HasPrefix(header, "W/") {
+		return -1, nil
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, errors.New("malformed entity tag")
+	}
+	version, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil || version <= 0 {
+		// A well-formed tag this server never issued.
+		return -1, nil
+	}
+	return version, nil
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIfMatch(t *testing.T) {
+	cases := []struct {
+		header  string
+		version int64
+		invalid bool
+	}{
+		{header: "", version: 0},
+		{header: "*", version: models.AnyVersion},
+		{header: `"7"`, version: 7},
+		{header: ` "7" `, version: 7},
+		{header: `W/"7"`, version: -1},
+		{header: `"abc"`, version: -1},
+		{header: `"0"`, version: -1},
+		{header: `7`, invalid: true},
+		{header: `"7", "8"`, invalid: true},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(fiber.MethodPut, "/", nil)
+		if tc.header != "" {
+			req.Header.Set(fiber.HeaderIfMatch, tc.header)
+		}
+		serve(t, "/", func(ctx *fiber.Ctx) error {
+			version, err := ifMatch(ctx)
+			if tc.invalid {
+				assert.Error(t, err, tc.header)
+			} else {
+				assert.NoError(t, err, tc.header)
+				assert.Equal(t, tc.version, version, tc.header)
+			}
+			return nil
+		}, req)
+	}
+	assert.Equal(t, `"12"`, etag(12))
+}
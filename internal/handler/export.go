@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"app/internal/apperr"
+	"app/internal/models"
+	"app/internal/tracing"
+
+	fiber "github.com/gofiber/fiber/v2"
+)
+
+// exportParams whitelists the query parameters of GET /users/export.
+var exportParams = map[string]bool{
+	"format":        true,
+	"name_prefix":   true,
+	"name_contains": true,
+	"age_min":       true,
+	"age_max":       true,
+}
+
+// exportEncoder writes exported users in one format. close writes whatever
+// the format needs after the last user and flushes.
+type exportEncoder interface {
+	encode(user *models.User) error
+	close() error
+}
+
+type exportFormat struct {
+	contentType string
+	newEncoder  func(w io.Writer) exportEncoder
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":    {contentType: "text/csv; charset=utf-8", newEncoder: newCSVEncoder},
+	"ndjson": {contentType: mimeNDJSON, newEncoder: newNDJSONEncoder},
+	"json":   {contentType: fiber.MIMEApplicationJSON, newEncoder: newJSONEncoder},
+}
+
+// ExportUsers streams every user matching the listing filters as csv, ndjson
+// or json (the default). Rows go from a database cursor straight to the
+// response, gzipped when the client accepts it, so memory use does not grow
+// with the table. A failure after the first byte can only cut the body
+// short; it is logged.
+func (h *Handler) ExportUsers(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.ExportUsers")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	if param, ok := unknownParam(ctx, exportParams); ok {
+		slog.Info("ExportUsers: Unknown query parameter", "param", param)
+		return apperr.Validation("Unknown query parameter: " + param)
+	}
+	name := ctx.Query("format", "json")
+	format, ok := exportFormats[name]
+	if !ok {
+		slog.Info("ExportUsers: Invalid format", "format", name)
+		return apperr.Validation("Invalid format")
+	}
+	filter, err := parseUserFilter(ctx)
+	if err != nil {
+		slog.Info("ExportUsers: Invalid filter", "error", err)
+		return apperr.Validation("Invalid filter")
+	}
+
+	ctx.Attachment("users." + name)
+	ctx.Set(fiber.HeaderContentType, format.contentType)
+	ctx.Set(fiber.HeaderVary, fiber.HeaderAcceptEncoding)
+	compress := ctx.Context().Request.Header.HasAcceptEncoding("gzip")
+	if compress {
+		ctx.Set(fiber.HeaderContentEncoding, "gzip")
+	}
+
+	// The writer runs after the handler has returned and ctx is recycled,
+	// so it only uses what is captured here.
+	userCtx := ctx.UserContext()
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		streamCtx, span := tracing.Start(userCtx, "Handler.StreamUsers")
+		defer span.End()
+
+		out := io.Writer(w)
+		var gz *gzip.Writer
+		if compress {
+			gz = gzip.NewWriter(w)
+			out = gz
+		}
+		enc := format.newEncoder(out)
+
+		count := 0
+		err := h.userUC.ExportUsers(streamCtx, filter, func(user *models.User) error {
+			count++
+			return enc.encode(user)
+		})
+		if err == nil {
+			err = enc.close()
+		}
+		if err == nil && gz != nil {
+			err = gz.Close()
+		}
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			slog.Info("ExportUsers: Export cut short", "format", name, "count", count, "error", err)
+			return
+		}
+		slog.Info("ExportUsers: Users exported", "format", name, "count", count)
+	})
+	return nil
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVEncoder(w io.Writer) exportEncoder {
+	cw := csv.NewWriter(w)
+	// Errors are sticky in csv.Writer and reported by the next encode or close.
+	_ = cw.Write([]string{"id", "name", "age"})
+	return &csvEncoder{w: cw, record: make([]string, 3)}
+}
+
+func (e *csvEncoder) encode(user *models.User) error {
+	e.record[0], e.record[1], e.record[2] = user.ID, user.Name, strconv.Itoa(user.Age)
+	return e.w.Write(e.record)
+}
+
+func (e *csvEncoder) close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) exportEncoder {
+	return &ndjsonEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *ndjsonEncoder) encode(user *models.User) error {
+	return e.enc.Encode(user.ToResponse())
+}
+
+func (e *ndjsonEncoder) close() error {
+	return nil
+}
+
+// jsonEncoder writes a single JSON array, one element at a time.
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONEncoder(w io.Writer) exportEncoder {
+	return &jsonEncoder{w: w}
+}
+
+func (e *jsonEncoder) encode(user *models.User) error {
+	data, err := json.Marshal(user.ToResponse())
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if e.count == 0 {
+		sep = "["
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonEncoder) close() error {
+	end := "]"
+	if e.count == 0 {
+		end = "[]"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
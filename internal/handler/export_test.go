@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func getExport(t *testing.T, users *MockUserProvider, target string, gzipped bool) (int, string, string) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, target, nil)
+	if gzipped {
+		req.Header.Set(fiber.HeaderAcceptEncoding, "gzip")
+	}
+	resp := serve(t, "/users/export", (&Handler{userUC: users}).ExportUsers, req)
+
+	body := io.Reader(resp.Body)
+	if gzipped && resp.StatusCode == fiber.StatusOK {
+		require.Equal(t, "gzip", resp.Header.Get(fiber.HeaderContentEncoding))
+		gz, err := gzip.NewReader(resp.Body)
+		require.NoError(t, err)
+		body = gz
+	}
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	return resp.StatusCode, resp.Header.Get(fiber.HeaderContentType), string(data)
+}
+
+var exported = []*models.User{
+	{ID: "1", Name: "Ann", Age: 30},
+	{ID: "2", Name: "Bob, Jr.", Age: 40},
+}
+
+func TestExportUsers_Formats(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("ExportUsers", mock.Anything, models.UserFilter{}, mock.Anything).Return(exported, nil).Times(3)
+	users.On("ExportUsers", mock.Anything, models.UserFilter{}, mock.Anything).Return(nil, nil).Once()
+
+	status, contentType, body := getExport(t, users, "/users/export?format=csv", false)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "text/csv; charset=utf-8", contentType)
+	assert.Equal(t, "id,name,age\n1,Ann,30\n2,\"Bob, Jr.\",40\n", body)
+
+	_, contentType, body = getExport(t, users, "/users/export?format=ndjson", false)
+	assert.Equal(t, mimeNDJSON, contentType)
+	assert.Equal(t, "{\"id\":\"1\",\"name\":\"Ann\",\"age\":30}\n{\"id\":\"2\",\"name\":\"Bob, Jr.\",\"age\":40}\n", body)
+
+	_, _, body = getExport(t, users, "/users/export", false)
+	var resp []models.UserResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	assert.Equal(t, models.ToResponseList(exported), resp)
+
+	_, _, body = getExport(t, users, "/users/export?format=json", false)
+	assert.Equal(t, "[]", body)
+	users.AssertExpectations(t)
+}
+
+func TestExportUsers_GzipAndFilter(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("ExportUsers", mock.Anything, mock.MatchedBy(func(f models.UserFilter) bool {
+		return f.AgeMin != nil && *f.AgeMin == 35
+	}), mock.Anything).Return(exported[1:], nil).Once()
+
+	status, _, body := getExport(t, users, "/users/export?format=csv&age_min=35", true)
+
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "id,name,age\n2,\"Bob, Jr.\",40\n", body)
+	users.AssertExpectations(t)
+}
+
+func TestExportUsers_InvalidParams(t *testing.T) {
+	for _, target := range []string{"/users/export?format=xml", "/users/export?limit=5", "/users/export?age_min=x"} {
+		status, _, _ := getExport(t, new(MockUserProvider), target, false)
+		assert.Equal(t, fiber.StatusBadRequest, status, target)
+	}
+}
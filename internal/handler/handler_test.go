@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockUserProvider struct {
+	mock.Mock
+}
+
+func (m *MockUserProvider) CreateUser(ctx context.Context, user *models.User) (string, error) {
+	args := m.Called(ctx, user)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockUserProvider) UpdateUser(ctx context.Context, user *models.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
+func (m *MockUserProvider) UpsertUser(ctx context.Context, user *models.User) (bool, error) {
+	args := m.Called(ctx, user)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserProvider) GetUser(ctx context.Context, id string) (*models.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserProvider) PatchUser(ctx context.Context, id string, patch models.UserPatch, version int64) (*models.User, error) {
+	args := m.Called(ctx, id, patch, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserProvider) DeleteUser(ctx context.Context, id string, version int64) error {
+	args := m.Called(ctx, id, version)
+	return args.Error(0)
+}
+
+func (m *MockUserProvider) RestoreUser(ctx context.Context, id string) (*models.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockUserProvider) GetAllUsers(ctx context.Context, q models.UserQuery) ([]*models.User, error) {
+	args := m.Called(ctx, q)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.User), args.Error(1)
+}
+
+func (m *MockUserProvider) CountUsers(ctx context.Context, filter models.UserFilter) (models.UserCount, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(models.UserCount), args.Error(1)
+}
+
+func (m *MockUserProvider) SearchUsers(ctx context.Context, term string, limit int) ([]*models.UserMatch, error) {
+	args := m.Called(ctx, term, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.UserMatch), args.Error(1)
+}
+
+func (m *MockUserProvider) CreateUsers(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	args := m.Called(ctx, users, mode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.BulkResult), args.Error(1)
+}
+
+func (m *MockUserProvider) UpdateUsers(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	args := m.Called(ctx, users, mode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.BulkResult), args.Error(1)
+}
+
+func (m *MockUserProvider) DeleteUsers(ctx context.Context, ids []string, mode models.BulkMode) ([]models.BulkResult, error) {
+	args := m.Called(ctx, ids, mode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.BulkResult), args.Error(1)
+}
+
+// ExportUsers passes the users given to Return to fn, then returns the error
+// given after them.
+func (m *MockUserProvider) ExportUsers(ctx context.Context, filter models.UserFilter, fn func(*models.User) error) error {
+	args := m.Called(ctx, filter, fn)
+	users, _ := args.Get(0).([]*models.User)
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+// serve sends req to an app that routes it to h under route, configured like
+// the one getRouter builds. The response body is closed when the test ends.
+func serve(t *testing.T, route string, h fiber.Handler, req *http.Request) *http.Response {
+	t.Helper()
+	app := fiber.New(fiber.Config{StreamRequestBody: true, ErrorHandler: ErrorHandler})
+	app.Add(req.Method, route, h)
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"strconv"
+	"strings"
+
+	"app/internal/apperr"
+	"app/internal/models"
+	"app/internal/tracing"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// importChunk is the number of rows written per COPY.
+	importChunk = 1000
+	// maxImportErrors caps the row errors listed in an import report; the
+	// failed count keeps counting past it.
+	maxImportErrors = 1000
+	// maxNDJSONLine caps a single NDJSON row.
+	maxNDJSONLine = 64 << 10
+)
+
+// Content types accepted by ImportUsers.
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+type importRowError struct {
+	Line   int                 `json:"line"`
+	Error  string              `json:"error"`
+	Errors []apperr.FieldError `json:"errors,omitempty"`
+}
+
+type importReport struct {
+	Imported        int              `json:"imported"`
+	Failed          int              `json:"failed"`
+	Errors          []importRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errors_truncated,omitempty"`
+}
+
+// importer validates rows and writes them in chunks as they are parsed.
+// fields describes a failed validation of a row.
+type importer struct {
+	write  func(users []*models.User) ([]models.BulkResult, error)
+	fields func(err error) []apperr.FieldError
+	users  []*models.User
+	lines  []int
+	report importReport
+}
+
+func (im *importer) fail(line int, msg string, fields ...apperr.FieldError) {
+	im.report.Failed++
+	if len(im.report.Errors) < maxImportErrors {
+		im.report.Errors = append(im.report.Errors, importRowError{Line: line, Error: msg, Errors: fields})
+	} else {
+		im.report.ErrorsTruncated = true
+	}
+}
+
+func (im *importer) add(line int, req models.CreateUserRequest) error {
+	if err := req.Validate(); err != nil {
+		im.fail(line, "Invalid input", im.fields(err)...)
+		return nil
+	}
+	user := models.ToEntityFromCreate(req)
+	im.users = append(im.users, &user)
+	im.lines = append(im.lines, line)
+	if len(im.users) >= importChunk {
+		return im.flush()
+	}
+	return nil
+}
+
+func (im *importer) flush() error {
+	if len(im.users) == 0 {
+		return nil
+	}
+	results, err := im.write(im.users)
+	if err != nil {
+		return err
+	}
+	for k, res := range results {
+		if res.Err != nil {
+			im.fail(im.lines[k], "Failed to write user")
+		} else {
+			im.report.Imported++
+		}
+	}
+	im.users, im.lines = im.users[:0], im.lines[:0]
+	return nil
+}
+
+// parseError is a malformed body that stops the import. Rows before it have
+// been written.
+type parseError struct {
+	line int
+	msg  string
+}
+
+func (e *parseError) Error() string {
+	return "line " + strconv.Itoa(e.line) + ": " + e.msg
+}
+
+// ImportUsers creates users from a text/csv or application/x-ndjson body,
+// reading it as it arrives and writing every importChunk valid rows with
+// COPY. CSV needs a header naming the name and age columns. Invalid rows are
+// skipped and listed by line in the report.
+func (h *Handler) ImportUsers(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.ImportUsers")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	contentType, _, err := mime.ParseMediaType(ctx.Get(fiber.HeaderContentType))
+	if err != nil || (contentType != mimeCSV && contentType != mimeNDJSON) {
+		slog.Info("ImportUsers: Unsupported content type", "content_type", ctx.Get(fiber.HeaderContentType))
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "Content type must be text/csv or application/x-ndjson")
+	}
+
+	body := ctx.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(ctx.Body())
+	}
+
+	im := &importer{
+		write: func(users []*models.User) ([]models.BulkResult, error) {
+			return h.userUC.CreateUsers(ctx.UserContext(), users, models.BulkBestEffort)
+		},
+		fields: func(err error) []apperr.FieldError {
+			return fieldErrors(ctx, err)
+		},
+		report: importReport{Errors: []importRowError{}},
+	}
+	if contentType == mimeCSV {
+		err = readCSV(body, im)
+	} else {
+		err = readNDJSON(body, im)
+	}
+	if err == nil {
+		err = im.flush()
+	}
+
+	report := im.report
+	var perr *parseError
+	switch {
+	case errors.As(err, &perr):
+		slog.Info("ImportUsers: Malformed body", "error", err, "imported", report.Imported)
+		p := newProblem(fiber.StatusBadRequest, "Malformed body at "+perr.Error())
+		p.Extensions = map[string]any{"report": report}
+		return sendProblem(ctx, p)
+	case err != nil:
+		// The report tells the client which rows were written before the
+		// failure, so it goes out with the problem.
+		slog.Error("ImportUsers: Failed to write users", "error", err, "imported", report.Imported)
+		p := problemFor(err)
+		p.Extensions = map[string]any{"report": report}
+		return sendProblem(ctx, p)
+	}
+
+	status := fiber.StatusOK
+	switch {
+	case report.Failed > 0 && report.Imported > 0:
+		status = fiber.StatusMultiStatus
+	case report.Failed > 0:
+		status = fiber.StatusUnprocessableEntity
+	}
+	slog.Info("ImportUsers: Import finished", "format", contentType, "imported", report.Imported, "failed", report.Failed)
+	return ctx.Status(status).JSON(report)
+}
+
+func readCSV(r io.Reader, im *importer) error {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return &parseError{line: 1, msg: "invalid CSV header"}
+	}
+	nameCol, ageCol := -1, -1
+	for i, col := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(col, "\ufeff"))) {
+		case "name":
+			nameCol = i
+		case "age":
+			ageCol = i
+		}
+	}
+	if nameCol < 0 || ageCol < 0 {
+		return &parseError{line: 1, msg: "CSV header must name the name and age columns"}
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var csvErr *csv.ParseError
+			if errors.As(err, &csvErr) && errors.Is(csvErr.Err, csv.ErrFieldCount) {
+				im.fail(csvErr.StartLine, "Wrong number of fields")
+				continue
+			}
+			if errors.As(err, &csvErr) {
+				return &parseError{line: csvErr.StartLine, msg: csvErr.Err.Error()}
+			}
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+
+		age, err := strconv.Atoi(strings.TrimSpace(record[ageCol]))
+		if err != nil {
+			im.fail(line, "Invalid age")
+			continue
+		}
+		if err := im.add(line, models.CreateUserRequest{Name: record[nameCol], Age: age}); err != nil {
+			return err
+		}
+	}
+}
+
+func readNDJSON(r io.Reader, im *importer) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), maxNDJSONLine)
+
+	line := 0
+	for sc.Scan() {
+		line++
+		row := bytes.TrimSpace(sc.Bytes())
+		if len(row) == 0 {
+			continue
+		}
+		var req models.CreateUserRequest
+		if err := json.Unmarshal(row, &req); err != nil {
+			im.fail(line, "Invalid JSON")
+			continue
+		}
+		if err := im.add(line, req); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return &parseError{line: line + 1, msg: "line too long"}
+		}
+		return err
+	}
+	return nil
+}
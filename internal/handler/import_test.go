@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app/internal/apperr"
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func postImport(t *testing.T, users *MockUserProvider, contentType, body string) (int, importReport) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, "/users/import", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp := serve(t, "/users/import", (&Handler{userUC: users}).ImportUsers, req)
+
+	var report importReport
+	if resp.StatusCode < fiber.StatusBadRequest || resp.StatusCode == fiber.StatusUnprocessableEntity {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	}
+	return resp.StatusCode, report
+}
+
+// usersNamed matches a batch of users with exactly these names, in order.
+func usersNamed(names ...string) any {
+	return mock.MatchedBy(func(users []*models.User) bool {
+		if len(users) != len(names) {
+			return false
+		}
+		for i, user := range users {
+			if user.Name != names[i] {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func TestImportUsers_CSV(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("CreateUsers", mock.Anything, usersNamed("Ann", "dup", "Eve, Jr."), models.BulkBestEffort).
+		Return([]models.BulkResult{{ID: "1"}, {Err: apperr.ErrAborted}, {ID: "3"}}, nil).Once()
+
+	body := "age,Name\n30,Ann\nx,Bob\n200,Cid\n40\n25,dup\n\"41\",\"Eve, Jr.\"\n"
+	status, report := postImport(t, users, "text/csv; charset=utf-8", body)
+
+	assert.Equal(t, fiber.StatusMultiStatus, status)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 4, report.Failed)
+	assert.Equal(t, []importRowError{
+		{Line: 3, Error: "Invalid age"},
+		{Line: 4, Error: "Invalid input", Errors: []apperr.FieldError{
+			{Field: "age", Rule: "lte", Message: "age must be 150 or less"},
+		}},
+		{Line: 5, Error: "Wrong number of fields"},
+		{Line: 6, Error: "Failed to write user"},
+	}, report.Errors)
+	users.AssertExpectations(t)
+}
+
+func TestImportUsers_CSVMissingColumn(t *testing.T) {
+	users := new(MockUserProvider)
+	status, _ := postImport(t, users, "text/csv", "name\nAnn\n")
+
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	users.AssertNotCalled(t, "CreateUsers", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestImportUsers_NDJSON(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("CreateUsers", mock.Anything, usersNamed("Ann"), models.BulkBestEffort).
+		Return([]models.BulkResult{{ID: "1"}}, nil).Once()
+
+	body := "{\"name\":\"Ann\",\"age\":30}\n\n{oops\n{\"name\":\"\",\"age\":20}\n"
+	status, report := postImport(t, users, "application/x-ndjson", body)
+
+	assert.Equal(t, fiber.StatusMultiStatus, status)
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, []importRowError{
+		{Line: 3, Error: "Invalid JSON"},
+		{Line: 4, Error: "Invalid input", Errors: []apperr.FieldError{
+			{Field: "name", Rule: "required", Message: "name is a required field"},
+		}},
+	}, report.Errors)
+	users.AssertExpectations(t)
+}
+
+func TestImportUsers_UnsupportedType(t *testing.T) {
+	status, _ := postImport(t, new(MockUserProvider), "application/json", "[]")
+	assert.Equal(t, fiber.StatusUnsupportedMediaType, status)
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"mime"
+
+	"app/internal/apperr"
+	"app/internal/models"
+	"app/internal/patch"
+	"app/internal/tracing"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Content types accepted by PatchUser.
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+)
+
+// maxPatchAttempts bounds how often PatchUser re-reads the user and applies
+// the patch again after losing a race with another write.
+const maxPatchAttempts = 3
+
+// invalidPatchResult is a patch that applies but leaves an invalid user.
+// cause holds the decoding or models.Validate error when that is why; it is
+// only reported as the fields it names.
+type invalidPatchResult struct {
+	msg   string
+	cause error
+}
+
+func (e *invalidPatchResult) Error() string {
+	return e.msg
+}
+
+// PatchUser applies a JSON Merge Patch or JSON Patch to the user and writes
+// only the fields it changes. The write is conditional on the version the
+// patch was applied to: with an If-Match tag a mismatch is a 412, without
+// one the patch is retried against the newer version. Under any If-Match a
+// missing user is a 412.
+func (h *Handler) PatchUser(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.PatchUser")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	id := ctx.Params("id")
+	if _, err := uuid.Parse(id); err != nil {
+		slog.Info("PatchUser: Invalid UUID", "id", id, "error", err)
+		return apperr.Validation("Invalid UUID")
+	}
+
+	var apply func(doc any) (any, error)
+	contentType, _, err := mime.ParseMediaType(ctx.Get(fiber.HeaderContentType))
+	switch {
+	case err != nil:
+	case contentType == mimeMergePatch:
+		var p any
+		if err := json.Unmarshal(ctx.Body(), &p); err != nil {
+			slog.Info("PatchUser: Invalid merge patch", "id", id, "error", err)
+			return apperr.Validation("Invalid patch")
+		}
+		apply = func(doc any) (any, error) { return patch.Merge(doc, p), nil }
+	case contentType == mimeJSONPatch:
+		ops, err := patch.Decode(ctx.Body())
+		if err != nil {
+			slog.Info("PatchUser: Invalid JSON patch", "id", id, "error", err)
+			return apperr.Validation("Invalid patch")
+		}
+		apply = func(doc any) (any, error) { return patch.Apply(doc, ops) }
+	}
+	if apply == nil {
+		slog.Info("PatchUser: Unsupported content type", "content_type", ctx.Get(fiber.HeaderContentType))
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "Content type must be "+mimeMergePatch+" or "+mimeJSONPatch)
+	}
+
+	version, err := ifMatch(ctx)
+	if err != nil {
+		slog.Info("PatchUser: Invalid If-Match", "if_match", ctx.Get(fiber.HeaderIfMatch), "error", err)
+		return apperr.Validation("Invalid If-Match")
+	}
+
+	for attempt := 1; ; attempt++ {
+		current, err := h.patchTarget(ctx, id, version)
+		if err != nil {
+			return err
+		}
+
+		next, err := patchUser(current, apply)
+		if err != nil {
+			var invalid *invalidPatchResult
+			if errors.As(err, &invalid) {
+				slog.Info("PatchUser: Patched user is invalid", "id", id, "error", err)
+				return apperr.Unprocessable(invalid.msg, fieldErrors(ctx, invalid.cause)...).WithCause(invalid.cause)
+			}
+			slog.Info("PatchUser: Patch does not apply", "id", id, "error", err)
+			return apperr.Conflict("Patch does not apply")
+		}
+
+		// The write is conditional on If-Match when there is one, else on
+		// the version the patch was applied to.
+		expected := version
+		if expected == 0 || expected == models.AnyVersion {
+			expected = current.Version
+		}
+		user, err := h.userUC.PatchUser(ctx.UserContext(), id, current.Diff(*next), expected)
+		switch {
+		case err == nil:
+			slog.Info("PatchUser: User patched", "id", id, "version", user.Version)
+			ctx.Set(fiber.HeaderETag, etag(user.Version))
+			return ctx.JSON(user.ToResponse())
+		case errors.Is(err, apperr.ErrNotFound):
+			return missingPatchTarget(id, version)
+		case errors.Is(err, apperr.ErrPreconditionFailed) && version != 0 && version != models.AnyVersion:
+			slog.Info("PatchUser: Version mismatch", "id", id, "version", version)
+			return apperr.PreconditionFailed("User has been modified")
+		case errors.Is(err, apperr.ErrPreconditionFailed) && attempt < maxPatchAttempts:
+			slog.Info("PatchUser: Lost a race, retrying", "id", id, "attempt", attempt)
+		case errors.Is(err, apperr.ErrPreconditionFailed):
+			slog.Info("PatchUser: Giving up after concurrent writes", "id", id, "attempts", attempt)
+			return apperr.Conflict("User is being modified concurrently")
+		default:
+			slog.Info("PatchUser: Failed to patch user", "id", id, "error", err)
+			return err
+		}
+	}
+}
+
+// patchTarget reads the user a patch applies to. A copy at another version
+// than If-Match asks for may just be stale, so it is not trusted to fail the
+// precondition: the repository checks the version instead, which also
+// brings the copy up to date.
+func (h *Handler) patchTarget(ctx *fiber.Ctx, id string, version int64) (*models.User, error) {
+	user, err := h.userUC.GetUser(ctx.UserContext(), id)
+	if err == nil && !user.AtVersion(version) {
+		user, err = h.userUC.PatchUser(ctx.UserContext(), id, models.UserPatch{}, version)
+	}
+	switch {
+	case err == nil:
+		return user, nil
+	case errors.Is(err, apperr.ErrNotFound):
+		return nil, missingPatchTarget(id, version)
+	case errors.Is(err, apperr.ErrPreconditionFailed):
+		slog.Info("PatchUser: Version mismatch", "id", id, "version", version)
+		return nil, apperr.PreconditionFailed("User has been modified")
+	default:
+		slog.Info("PatchUser: Failed to get user", "id", id, "error", err)
+		return nil, err
+	}
+}
+
+// missingPatchTarget is the error for a user that does not exist: a failed
+// precondition when the patch has one.
+func missingPatchTarget(id string, version int64) error {
+	if version != 0 {
+		slog.Info("PatchUser: User not found", "id", id, "version", version)
+		return apperr.PreconditionFailed("User does not exist")
+	}
+	slog.Info("PatchUser: User not found", "id", id)
+	return apperr.NotFound("User not found")
+}
+
+// patchUser applies apply to the JSON form of user and validates the result
+// with the rules of a full update.
+func patchUser(user *models.User, apply func(doc any) (any, error)) (*models.User, error) {
+	data, err := json.Marshal(user.ToResponse())
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	patched, err := apply(doc)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(patched); err != nil {
+		return nil, err
+	}
+
+	var req models.UpdateUserRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return nil, &invalidPatchResult{msg: "Patched user is malformed", cause: err}
+	}
+	if req.ID != user.ID {
+		return nil, &invalidPatchResult{msg: "The id cannot be changed"}
+	}
+	if err := models.Validate(&req); err != nil {
+		return nil, &invalidPatchResult{msg: "Invalid input", cause: err}
+	}
+
+	next := models.ToEntityFromUpdate(req)
+	return &next, nil
+}
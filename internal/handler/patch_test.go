@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"app/internal/apperr"
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const patchID = "0b0c7a8e-4f5d-4f3c-9a59-2b3e3c1f6d10"
+
+func sendPatch(t *testing.T, users *MockUserProvider, contentType, body, ifMatch string) (int, string, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPatch, "/user/"+patchID, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	if ifMatch != "" {
+		req.Header.Set(fiber.HeaderIfMatch, ifMatch)
+	}
+	resp := serve(t, "/user/:id", (&Handler{userUC: users}).PatchUser, req)
+
+	var out map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	return resp.StatusCode, resp.Header.Get(fiber.HeaderETag), out
+}
+
+// patchTarget is the user the patch tests start from, at the given version.
+func patchTarget(name string, age int, version int64) *models.User {
+	return &models.User{ID: patchID, Name: name, Age: age, Version: version}
+}
+
+func TestPatchUser_MergePatchWritesOnlyChanges(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Once()
+	age := 31
+	users.On("PatchUser", mock.Anything, patchID, models.UserPatch{Age: &age}, int64(4)).
+		Return(patchTarget("Ann", 31, 5), nil).Once()
+
+	status, tag, body := sendPatch(t, users, mimeMergePatch, `{"age":31,"name":"Ann"}`, "")
+
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, `"5"`, tag)
+	assert.Equal(t, float64(31), body["age"])
+	users.AssertExpectations(t)
+}
+
+func TestPatchUser_JSONPatch(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Once()
+	name := "Anna"
+	users.On("PatchUser", mock.Anything, patchID, models.UserPatch{Name: &name}, int64(4)).
+		Return(patchTarget("Anna", 30, 5), nil).Once()
+
+	status, _, body := sendPatch(t, users, mimeJSONPatch,
+		`[{"op":"test","path":"/name","value":"Ann"},{"op":"replace","path":"/name","value":"Anna"}]`, `"4"`)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "Anna", body["name"])
+
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Anna", 30, 5), nil).Once()
+	status, _, _ = sendPatch(t, users, mimeJSONPatch, `[{"op":"test","path":"/name","value":"Ann"}]`, "")
+	assert.Equal(t, fiber.StatusConflict, status)
+	users.AssertExpectations(t)
+}
+
+func TestPatchUser_Rejects(t *testing.T) {
+	cases := []struct {
+		name, contentType, body string
+		status                  int
+	}{
+		{"malformed patch", mimeMergePatch, `{`, fiber.StatusBadRequest},
+		{"invalid ops", mimeJSONPatch, `[{"op":"nope","path":"/a"}]`, fiber.StatusBadRequest},
+		{"content type", fiber.MIMEApplicationJSON, `{"age":31}`, fiber.StatusUnsupportedMediaType},
+		{"invalid age", mimeMergePatch, `{"age":500}`, fiber.StatusUnprocessableEntity},
+		{"removed name", mimeMergePatch, `{"name":null}`, fiber.StatusUnprocessableEntity},
+		{"unknown field", mimeMergePatch, `{"email":"a@b.c"}`, fiber.StatusUnprocessableEntity},
+		{"changed id", mimeJSONPatch, `[{"op":"replace","path":"/id","value":"x"}]`, fiber.StatusUnprocessableEntity},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			users := new(MockUserProvider)
+			users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Maybe()
+
+			status, _, _ := sendPatch(t, users, tc.contentType, tc.body, "")
+			assert.Equal(t, tc.status, status)
+			users.AssertNotCalled(t, "PatchUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestPatchUser_InvalidResultListsFields(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Once()
+
+	status, _, body := sendPatch(t, users, mimeMergePatch, `{"age":500}`, "")
+
+	assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+	assert.Equal(t, []any{map[string]any{"field": "age", "rule": "lte", "message": "age must be 150 or less"}}, body["errors"])
+	users.AssertExpectations(t)
+}
+
+func TestPatchUser_MalformedResultNamesField(t *testing.T) {
+	cases := []struct {
+		body  string
+		field map[string]any
+	}{
+		{`{"age":"old"}`, map[string]any{"field": "age", "rule": "type", "message": "age has the wrong type"}},
+		{`{"email":"a@b.c"}`, map[string]any{"field": "email", "rule": "unknown", "message": "email is not a known field"}},
+	}
+	for _, tc := range cases {
+		users := new(MockUserProvider)
+		users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Once()
+
+		status, _, body := sendPatch(t, users, mimeMergePatch, tc.body, "")
+
+		assert.Equal(t, fiber.StatusUnprocessableEntity, status, tc.body)
+		assert.Equal(t, "Patched user is malformed", body["detail"], "decoder errors must not leak")
+		assert.Equal(t, []any{tc.field}, body["errors"], tc.body)
+		users.AssertExpectations(t)
+	}
+}
+
+func TestPatchUser_Concurrency(t *testing.T) {
+	age := 31
+	patch := models.UserPatch{Age: &age}
+
+	users := new(MockUserProvider)
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Once()
+	users.On("PatchUser", mock.Anything, patchID, patch, int64(4)).Return(nil, apperr.ErrPreconditionFailed).Once()
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 5), nil).Once()
+	users.On("PatchUser", mock.Anything, patchID, patch, int64(5)).Return(patchTarget("Ann", 31, 6), nil).Once()
+	status, tag, _ := sendPatch(t, users, mimeMergePatch, `{"age":31}`, "")
+	assert.Equal(t, fiber.StatusOK, status, "a lost race is retried without If-Match")
+	assert.Equal(t, `"6"`, tag)
+	users.AssertExpectations(t)
+
+	users = new(MockUserProvider)
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Times(maxPatchAttempts)
+	users.On("PatchUser", mock.Anything, patchID, patch, int64(4)).Return(nil, apperr.ErrPreconditionFailed).Times(maxPatchAttempts)
+	status, _, _ = sendPatch(t, users, mimeMergePatch, `{"age":31}`, "")
+	assert.Equal(t, fiber.StatusConflict, status)
+	users.AssertExpectations(t)
+
+}
+
+func TestPatchUser_IfMatch(t *testing.T) {
+	age := 31
+	patch := models.UserPatch{Age: &age}
+
+	users := new(MockUserProvider)
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Once()
+	users.On("PatchUser", mock.Anything, patchID, models.UserPatch{}, int64(3)).Return(nil, apperr.ErrPreconditionFailed).Once()
+	status, _, _ := sendPatch(t, users, mimeMergePatch, `{"age":31}`, `"3"`)
+	assert.Equal(t, fiber.StatusPreconditionFailed, status)
+	users.AssertExpectations(t)
+
+	users = new(MockUserProvider)
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Once()
+	users.On("PatchUser", mock.Anything, patchID, models.UserPatch{}, int64(5)).Return(patchTarget("Ann", 30, 5), nil).Once()
+	users.On("PatchUser", mock.Anything, patchID, patch, int64(5)).Return(patchTarget("Ann", 31, 6), nil).Once()
+	status, tag, _ := sendPatch(t, users, mimeMergePatch, `{"age":31}`, `"5"`)
+	assert.Equal(t, fiber.StatusOK, status, "a stale copy must not fail If-Match")
+	assert.Equal(t, `"6"`, tag)
+	users.AssertExpectations(t)
+}
+
+func TestPatchUser_IfMatchAny(t *testing.T) {
+	age := 31
+
+	users := new(MockUserProvider)
+	users.On("GetUser", mock.Anything, patchID).Return(patchTarget("Ann", 30, 4), nil).Once()
+	users.On("PatchUser", mock.Anything, patchID, models.UserPatch{Age: &age}, int64(4)).
+		Return(patchTarget("Ann", 31, 5), nil).Once()
+	status, tag, _ := sendPatch(t, users, mimeMergePatch, `{"age":31}`, "*")
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, `"5"`, tag)
+	users.AssertExpectations(t)
+
+	users = new(MockUserProvider)
+	users.On("GetUser", mock.Anything, patchID).Return(nil, apperr.ErrNotFound).Once()
+	status, _, _ = sendPatch(t, users, mimeMergePatch, `{"age":31}`, "*")
+	assert.Equal(t, fiber.StatusPreconditionFailed, status, "If-Match: * needs an existing user")
+	users.AssertExpectations(t)
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"app/internal/apperr"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+const mimeProblem = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Errors   []apperr.FieldError `json:"errors,omitempty"`
+	// Extensions are added to the object as extra members.
+	Extensions map[string]any `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	data, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return data, err
+	}
+	members := make(map[string]any, len(p.Extensions)+6)
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// kindStatus maps application error kinds to HTTP statuses.
+var kindStatus = map[apperr.Kind]int{
+	apperr.KindNotFound:           fiber.StatusNotFound,
+	apperr.KindConflict:           fiber.StatusConflict,
+	apperr.KindValidation:         fiber.StatusBadRequest,
+	apperr.KindPreconditionFailed: fiber.StatusPreconditionFailed,
+	apperr.KindUnavailable:        fiber.StatusServiceUnavailable,
+	apperr.KindUnprocessable:      fiber.StatusUnprocessableEntity,
+}
+
+func newProblem(status int, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// problemFor describes err to the client. Only apperr details and fiber's
+// own messages are shown; anything else is an internal error whose text
+// stays in the logs.
+func problemFor(err error) Problem {
+	var appErr *apperr.Error
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &appErr) && appErr.Kind != apperr.KindInternal:
+		p := newProblem(kindStatus[appErr.Kind], appErr.Detail)
+		p.Errors = appErr.Fields
+		return p
+	case errors.As(err, &fiberErr) && fiberErr.Code < fiber.StatusInternalServerError:
+		return newProblem(fiberErr.Code, fiberErr.Message)
+	case errors.As(err, &fiberErr):
+		return newProblem(fiberErr.Code, "")
+	case errors.Is(err, context.DeadlineExceeded):
+		return newProblem(fiber.StatusServiceUnavailable, "Request timed out")
+	default:
+		return newProblem(fiber.StatusInternalServerError, "")
+	}
+}
+
+// sendProblem writes p as the response.
+func sendProblem(ctx *fiber.Ctx, p Problem) error {
+	if p.Instance == "" {
+		p.Instance = ctx.Path()
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	ctx.Set(fiber.HeaderContentType, mimeProblem)
+	return ctx.Status(p.Status).Send(data)
+}
+
+// ErrorHandler is the fiber error handler: every error a handler returns is
+// answered with application/problem+json.
+func ErrorHandler(ctx *fiber.Ctx, err error) error {
+	p := problemFor(err)
+	if p.Status >= fiber.StatusInternalServerError {
+		slog.Error("ErrorHandler: Request failed", "method", ctx.Method(), "path", ctx.Path(), "status", p.Status, "error", err)
+	}
+	return sendProblem(ctx, p)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"app/internal/apperr"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		detail string
+	}{
+		{name: "not found", err: apperr.NotFound("User not found"), status: fiber.StatusNotFound, detail: "User not found"},
+		{name: "wrapped", err: errors.Wrap(apperr.PreconditionFailed("User has been modified"), "update"), status: fiber.StatusPreconditionFailed, detail: "User has been modified"},
+		{name: "unavailable", err: apperr.Unavailable("Database unavailable").WithCause(errors.New("dial tcp: refused")), status: fiber.StatusServiceUnavailable, detail: "Database unavailable"},
+		{name: "unprocessable", err: apperr.Unprocessable("The id cannot be changed"), status: fiber.StatusUnprocessableEntity, detail: "The id cannot be changed"},
+		{name: "fiber", err: fiber.NewError(fiber.StatusUnsupportedMediaType, "Wrong type"), status: fiber.StatusUnsupportedMediaType, detail: "Wrong type"},
+		{name: "internal", err: errors.New("pq: password authentication failed"), status: fiber.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := serve(t, "/user/:id", func(*fiber.Ctx) error { return tc.err },
+				httptest.NewRequest(fiber.MethodGet, "/user/1", nil))
+
+			assert.Equal(t, tc.status, resp.StatusCode)
+			assert.Equal(t, mimeProblem, resp.Header.Get(fiber.HeaderContentType))
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, float64(tc.status), body["status"])
+			assert.Equal(t, "/user/1", body["instance"])
+			if tc.detail == "" {
+				assert.NotContains(t, body, "detail")
+			} else {
+				assert.Equal(t, tc.detail, body["detail"])
+			}
+		})
+	}
+}
+
+func TestProblemExtensions(t *testing.T) {
+	p := newProblem(fiber.StatusBadRequest, "Invalid input")
+	p.Errors = []apperr.FieldError{{Field: "age", Rule: "lte", Message: "age must be at most 150"}}
+	p.Extensions = map[string]any{"report": map[string]int{"imported": 2}}
+
+	data, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Bad Request",
+		"status": 400,
+		"detail": "Invalid input",
+		"errors": [{"field": "age", "rule": "lte", "message": "age must be at most 150"}],
+		"report": {"imported": 2}
+	}`, string(data))
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/pkg/errors"
+)
+
+// userListParams whitelists the query parameters of GET /users.
+var userListParams = map[string]bool{
+	"limit":         true,
+	"offset":        true,
+	"cursor":        true,
+	"sort":          true,
+	"name_prefix":   true,
+	"name_contains": true,
+	"age_min":       true,
+	"age_max":       true,
+	"envelope":      true,
+}
+
+// adminUserListParams whitelists the query parameters of GET /users on the
+// admin API.
+var adminUserListParams = func() map[string]bool {
+	params := map[string]bool{"include_deleted": true}
+	for param := range userListParams {
+		params[param] = true
+	}
+	return params
+}()
+
+// unknownParam returns the first query parameter that is not allowed.
+func unknownParam(ctx *fiber.Ctx, allowed map[string]bool) (string, bool) {
+	var unknown string
+	ctx.Context().QueryArgs().VisitAll(func(key, _ []byte) {
+		if unknown == "" && !allowed[string(key)] {
+			unknown = string(key)
+		}
+	})
+	return unknown, unknown != ""
+}
+
+// parseUserFilter reads the listing filters from the query string.
+func parseUserFilter(ctx *fiber.Ctx) (models.UserFilter, error) {
+	filter := models.UserFilter{
+		NamePrefix:   ctx.Query("name_prefix"),
+		NameContains: ctx.Query("name_contains"),
+	}
+	if raw := ctx.Query("include_deleted"); raw != "" {
+		include, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, errors.Wrap(err, "invalid include_deleted")
+		}
+		filter.IncludeDeleted = include
+	}
+	for param, bound := range map[string]**int{"age_min": &filter.AgeMin, "age_max": &filter.AgeMax} {
+		raw := ctx.Query(param)
+		if raw == "" {
+			continue
+		}
+		age, err := strconv.Atoi(raw)
+		if err != nil {
+			return filter, errors.Wrapf(err, "invalid %s", param)
+		}
+		*bound = &age
+	}
+	return filter, filter.Validate()
+}
+
+// requestQuery returns the request's query parameters, to build links to
+// neighbouring pages from.
+func requestQuery(ctx *fiber.Ctx) url.Values {
+	values, err := url.ParseQuery(string(ctx.Context().QueryArgs().QueryString()))
+	if err != nil {
+		return url.Values{}
+	}
+	return values
+}
+
+// pageLinks are the RFC 8288 relations of a page. Empty links are omitted.
+type pageLinks struct {
+	First string
+	Prev  string
+	Next  string
+	Last  string
+}
+
+// offsetLinks links an offset page of got users to its neighbours. With an
+// estimated total there is no last link, and next is offered whenever the
+// page came back full.
+func offsetLinks(base string, params url.Values, limit, offset, got int, count models.UserCount) pageLinks {
+	at := func(offset int) string {
+		q := url.Values{}
+		for k, v := range params {
+			q[k] = v
+		}
+		q.Set("limit", strconv.Itoa(limit))
+		q.Set("offset", strconv.Itoa(offset))
+		return base + "?" + q.Encode()
+	}
+
+	links := pageLinks{First: at(0)}
+	if offset > 0 {
+		links.Prev = at(max(0, offset-limit))
+	}
+	hasNext := int64(offset+limit) < count.Total
+	if count.Estimated {
+		hasNext = got == limit
+	}
+	if hasNext {
+		links.Next = at(offset + limit)
+	}
+	if !count.Estimated && count.Total > 0 {
+		links.Last = at(int((count.Total-1)/int64(limit)) * limit)
+	}
+	return links
+}
+
+// cursorLink links to the keyset page that starts after token.
+func cursorLink(base string, params url.Values, token string) string {
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+	q.Set("cursor", token)
+	return base + "?" + q.Encode()
+}
+
+// Header renders the links as a Link header value.
+func (l pageLinks) Header() string {
+	var parts []string
+	for _, link := range []struct{ rel, url string }{
+		{"first", l.First}, {"prev", l.Prev}, {"next", l.Next}, {"last", l.Last},
+	} {
+		if link.url != "" {
+			parts = append(parts, fmt.Sprintf(`<%s>; rel="%s"`, link.url, link.rel))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// orNil returns nil for an empty link, so it encodes as JSON null.
+func orNil(link string) *string {
+	if link == "" {
+		return nil
+	}
+	return &link
+}
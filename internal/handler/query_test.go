@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/url"
+	"testing"
+
+	"app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const base = "http://api.test/users"
+
+func TestOffsetLinks_MiddlePage(t *testing.T) {
+	params := url.Values{"sort": {"-age"}, "offset": {"20"}}
+	links := offsetLinks(base, params, 10, 20, 10, models.UserCount{Total: 45})
+
+	assert.Equal(t, base+"?limit=10&offset=0&sort=-age", links.First)
+	assert.Equal(t, base+"?limit=10&offset=10&sort=-age", links.Prev)
+	assert.Equal(t, base+"?limit=10&offset=30&sort=-age", links.Next)
+	assert.Equal(t, base+"?limit=10&offset=40&sort=-age", links.Last)
+	assert.Equal(t, []string{"20"}, params["offset"], "request params must not be modified")
+}
+
+func TestOffsetLinks_Edges(t *testing.T) {
+	first := offsetLinks(base, nil, 10, 0, 10, models.UserCount{Total: 10})
+	assert.Empty(t, first.Prev)
+	assert.Empty(t, first.Next, "no next page once the total is reached")
+	assert.Equal(t, first.First, first.Last)
+
+	empty := offsetLinks(base, nil, 10, 0, 0, models.UserCount{})
+	assert.Empty(t, empty.Last)
+
+	short := offsetLinks(base, nil, 10, 5, 10, models.UserCount{Total: 30})
+	assert.Equal(t, base+"?limit=10&offset=0", short.Prev, "prev never goes below zero")
+}
+
+func TestOffsetLinks_EstimatedTotal(t *testing.T) {
+	full := offsetLinks(base, nil, 10, 0, 10, models.UserCount{Total: 5, Estimated: true})
+	assert.NotEmpty(t, full.Next, "a full page may have more behind it whatever the estimate says")
+	assert.Empty(t, full.Last)
+
+	partial := offsetLinks(base, nil, 10, 0, 3, models.UserCount{Total: 5_000_000, Estimated: true})
+	assert.Empty(t, partial.Next)
+}
+
+func TestPageLinks_Header(t *testing.T) {
+	links := pageLinks{First: base + "?offset=0", Next: base + "?offset=10"}
+	assert.Equal(t, `<`+base+`?offset=0>; rel="first", <`+base+`?offset=10>; rel="next"`, links.Header())
+}
@@ -3,8 +3,11 @@ package handler
 import (
 	"log/slog"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"app/internal/apperr"
+	"app/internal/cursor"
 	"app/internal/models"
 	"app/internal/tracing"
 	"app/internal/usecase"
@@ -17,37 +20,58 @@ import (
 type UserHandler interface {
 	CreateUser(ctx *fiber.Ctx) error
 	UpdateUser(ctx *fiber.Ctx) error
+	UpsertUser(ctx *fiber.Ctx) error
 	GetUser(ctx *fiber.Ctx) error
+	PatchUser(ctx *fiber.Ctx) error
 	DeleteUser(ctx *fiber.Ctx) error
+	RestoreUser(ctx *fiber.Ctx) error
 	GetAllUsers(ctx *fiber.Ctx) error
+	SearchUsers(ctx *fiber.Ctx) error
+	CreateUsers(ctx *fiber.Ctx) error
+	UpdateUsers(ctx *fiber.Ctx) error
+	DeleteUsers(ctx *fiber.Ctx) error
+	ImportUsers(ctx *fiber.Ctx) error
+	ExportUsers(ctx *fiber.Ctx) error
 }
 
 type Handler struct {
-	userUC usecase.UserProvider
+	userUC  usecase.UserProvider
+	cursors *cursor.Signer
+	// admin allows the operator-only listing filters.
+	admin bool
 }
 
-func NewHandler(userUC *usecase.UserUsecase) *Handler {
+func NewHandler(userUC *usecase.UserUsecase, cursors *cursor.Signer) *Handler {
 	return &Handler{
-		userUC: userUC,
+		userUC:  userUC,
+		cursors: cursors,
 	}
 }
 
+// Admin returns a copy of h for the admin API, whose listings accept the
+// operator-only filters.
+func (h *Handler) Admin() *Handler {
+	admin := *h
+	admin.admin = true
+	return &admin
+}
+
 func (h *Handler) CreateUser(ctx *fiber.Ctx) error {
 	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.CreateUser")
 	defer span.End()
 	ctx.SetUserContext(ctxWithSpan)
 
-	var req models.CreateUserRequest
-	if err := ctx.BodyParser(&req); err != nil || req.Name == "" || req.Age <= 0 {
+	req, err := bind[models.CreateUserRequest](ctx)
+	if err != nil {
 		slog.Info("CreateUser: Invalid input", "error", err)
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		return err
 	}
 
-	user := models.ToEntityFromCreate(req)
+	user := models.ToEntityFromCreate(*req)
 	id, err := h.userUC.CreateUser(ctx.UserContext(), &user)
 	if err != nil {
 		slog.Info("CreateUser: Failed to create user", "user", user, "error", err)
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	slog.Info("CreateUser: User created", "id", id)
@@ -59,30 +83,99 @@ func (h *Handler) UpdateUser(ctx *fiber.Ctx) error {
 	defer span.End()
 	ctx.SetUserContext(ctxWithSpan)
 
-	var req models.UpdateUserRequest
-	if err := ctx.BodyParser(&req); err != nil || req.ID == "" || req.Name == "" || req.Age <= 0 {
+	req, err := bind[models.UpdateUserRequest](ctx)
+	if err != nil {
 		slog.Info("UpdateUser: Invalid input", "error", err)
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+		return err
 	}
-	if _, err := uuid.Parse(req.ID); err != nil {
-		slog.Info("UpdateUser: Invalid UUID", "id", req.ID, "error", err)
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid UUID"})
+
+	version, err := ifMatch(ctx)
+	if err != nil {
+		slog.Info("UpdateUser: Invalid If-Match", "if_match", ctx.Get(fiber.HeaderIfMatch), "error", err)
+		return apperr.Validation("Invalid If-Match")
 	}
 
-	user := models.ToEntityFromUpdate(req)
+	user := models.ToEntityFromUpdate(*req)
+	user.Version = version
 	if err := h.userUC.UpdateUser(ctx.UserContext(), &user); err != nil {
+		if errors.Is(err, apperr.ErrNotFound) && version != 0 {
+			slog.Info("UpdateUser: User not found", "id", req.ID, "version", version)
+			return apperr.PreconditionFailed("User does not exist")
+		}
 		if errors.Is(err, apperr.ErrNotFound) {
 			slog.Info("UpdateUser: User not found", "id", req.ID)
-			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			return apperr.NotFound("User not found")
+		}
+		if errors.Is(err, apperr.ErrPreconditionFailed) {
+			slog.Info("UpdateUser: Version mismatch", "id", req.ID, "version", version)
+			return apperr.PreconditionFailed("User has been modified")
 		}
 		slog.Info("UpdateUser: Failed to update user", "id", req.ID, "error", err)
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
+		return err
 	}
 
-	slog.Info("UpdateUser: User updated", "id", req.ID)
+	slog.Info("UpdateUser: User updated", "id", req.ID, "version", user.Version)
+	ctx.Set(fiber.HeaderETag, etag(user.Version))
 	return ctx.JSON(fiber.Map{"id": req.ID})
 }
 
+// UpsertUser creates the user with the id in the path, for clients that
+// choose their own ids, or replaces the user with that id. It answers 201
+// when the user was created and 200 when it was replaced. With If-Match
+// only an existing user at that version is replaced.
+func (h *Handler) UpsertUser(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.UpsertUser")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	parsed, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		slog.Info("UpsertUser: Invalid UUID", "id", ctx.Params("id"), "error", err)
+		return apperr.Validation("Invalid UUID")
+	}
+	// The canonical form, which is what the database returns and the cache
+	// is keyed on.
+	id := parsed.String()
+
+	req, err := bind[models.CreateUserRequest](ctx)
+	if err != nil {
+		slog.Info("UpsertUser: Invalid input", "id", id, "error", err)
+		return err
+	}
+	version, err := ifMatch(ctx)
+	if err != nil {
+		slog.Info("UpsertUser: Invalid If-Match", "if_match", ctx.Get(fiber.HeaderIfMatch), "error", err)
+		return apperr.Validation("Invalid If-Match")
+	}
+
+	user := models.ToEntityFromCreate(*req)
+	user.ID = id
+	user.Version = version
+	created, err := h.userUC.UpsertUser(ctx.UserContext(), &user)
+	switch {
+	case err == nil:
+	case errors.Is(err, apperr.ErrNotFound):
+		// Only a conditional write can miss: If-Match needs a current user.
+		slog.Info("UpsertUser: User not found", "id", id, "version", version)
+		return apperr.PreconditionFailed("User does not exist")
+	case errors.Is(err, apperr.ErrPreconditionFailed):
+		slog.Info("UpsertUser: Version mismatch", "id", id, "version", version)
+		return apperr.PreconditionFailed("User has been modified")
+	default:
+		slog.Info("UpsertUser: Failed to write user", "id", id, "error", err)
+		return err
+	}
+
+	ctx.Set(fiber.HeaderETag, etag(user.Version))
+	if created {
+		slog.Info("UpsertUser: User created", "id", id)
+		ctx.Location("/user/" + id)
+		return ctx.Status(fiber.StatusCreated).JSON(user.ToResponse())
+	}
+	slog.Info("UpsertUser: User replaced", "id", id, "version", user.Version)
+	return ctx.JSON(user.ToResponse())
+}
+
 func (h *Handler) GetUser(ctx *fiber.Ctx) error {
 	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.GetUser")
 	defer span.End()
@@ -91,23 +184,29 @@ func (h *Handler) GetUser(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
 	if _, err := uuid.Parse(id); err != nil {
 		slog.Info("GetUser: Invalid UUID", "id", id, "error", err)
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid UUID"})
+		return apperr.Validation("Invalid UUID")
 	}
 
 	user, err := h.userUC.GetUser(ctx.UserContext(), id)
 	if err != nil {
 		if errors.Is(err, apperr.ErrNotFound) {
 			slog.Info("GetUser: User not found", "id", id)
-			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			return apperr.NotFound("User not found")
 		}
 		slog.Info("GetUser: Failed to get user", "id", id, "error", err)
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
+		return err
 	}
 
 	slog.Info("GetUser: User found", "id", id)
+	// Users cached before versions existed have none to report.
+	if user.Version > 0 {
+		ctx.Set(fiber.HeaderETag, etag(user.Version))
+	}
 	return ctx.JSON(user.ToResponse())
 }
 
+// DeleteUser soft-deletes the user; RestoreUser can bring it back until it
+// is purged.
 func (h *Handler) DeleteUser(ctx *fiber.Ctx) error {
 	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.DeleteUser")
 	defer span.End()
@@ -116,40 +215,196 @@ func (h *Handler) DeleteUser(ctx *fiber.Ctx) error {
 	id := ctx.Params("id")
 	if _, err := uuid.Parse(id); err != nil {
 		slog.Info("DeleteUser: Invalid UUID", "id", id, "error", err)
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid UUID"})
+		return apperr.Validation("Invalid UUID")
 	}
 
-	if err := h.userUC.DeleteUser(ctx.UserContext(), id); err != nil {
+	version, err := ifMatch(ctx)
+	if err != nil {
+		slog.Info("DeleteUser: Invalid If-Match", "if_match", ctx.Get(fiber.HeaderIfMatch), "error", err)
+		return apperr.Validation("Invalid If-Match")
+	}
+
+	if err := h.userUC.DeleteUser(ctx.UserContext(), id, version); err != nil {
+		if errors.Is(err, apperr.ErrNotFound) && version != 0 {
+			slog.Info("DeleteUser: User not found", "id", id, "version", version)
+			return apperr.PreconditionFailed("User does not exist")
+		}
 		if errors.Is(err, apperr.ErrNotFound) {
 			slog.Info("DeleteUser: User not found", "id", id)
-			return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			return apperr.NotFound("User not found")
+		}
+		if errors.Is(err, apperr.ErrPreconditionFailed) {
+			slog.Info("DeleteUser: Version mismatch", "id", id, "version", version)
+			return apperr.PreconditionFailed("User has been modified")
 		}
 		slog.Info("DeleteUser: Failed to delete user", "id", id, "error", err)
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
+		return err
 	}
 
 	slog.Info("DeleteUser: User deleted", "id", id)
 	return ctx.SendStatus(fiber.StatusNoContent)
 }
 
+func (h *Handler) RestoreUser(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.RestoreUser")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	id := ctx.Params("id")
+	if _, err := uuid.Parse(id); err != nil {
+		slog.Info("RestoreUser: Invalid UUID", "id", id, "error", err)
+		return apperr.Validation("Invalid UUID")
+	}
+
+	user, err := h.userUC.RestoreUser(ctx.UserContext(), id)
+	if err != nil {
+		if errors.Is(err, apperr.ErrNotFound) {
+			slog.Info("RestoreUser: User not found", "id", id)
+			return apperr.NotFound("User not found")
+		}
+		slog.Info("RestoreUser: Failed to restore user", "id", id, "error", err)
+		return err
+	}
+
+	slog.Info("RestoreUser: User restored", "id", id, "version", user.Version)
+	ctx.Set(fiber.HeaderETag, etag(user.Version))
+	return ctx.JSON(user.ToResponse())
+}
+
+// GetAllUsers lists users by offset, or by keyset once the client passes a
+// cursor parameter (empty for the first page). Keyset pages are wrapped in
+// an object carrying the next_cursor to continue from. Offset pages report
+// the total in X-Total-Count and link their neighbours in Link; with
+// envelope=true the same metadata is returned in the body. On the admin API
+// include_deleted=true lists soft-deleted users too.
 func (h *Handler) GetAllUsers(ctx *fiber.Ctx) error {
 	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.GetAllUsers")
 	defer span.End()
 	ctx.SetUserContext(ctxWithSpan)
 
+	allowed := userListParams
+	if h.admin {
+		allowed = adminUserListParams
+	}
+	if param, ok := unknownParam(ctx, allowed); ok {
+		slog.Info("GetAllUsers: Unknown query parameter", "param", param)
+		return apperr.Validation("Unknown query parameter: " + param)
+	}
+
 	limit, err1 := strconv.Atoi(ctx.Query("limit", "10"))
 	offset, err2 := strconv.Atoi(ctx.Query("offset", "0"))
-	if err1 != nil || err2 != nil || limit <= 0 || offset < 0 {
+	envelope, err3 := strconv.ParseBool(ctx.Query("envelope", "false"))
+	if err1 != nil || err2 != nil || err3 != nil || limit <= 0 || offset < 0 {
 		slog.Info("GetAllUsers: Invalid pagination parameters", "limit", limit, "offset", offset)
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid pagination params"})
+		return apperr.Validation("Invalid pagination params")
 	}
 
-	users, err := h.userUC.GetAllUsers(ctx.UserContext(), limit, offset)
+	sort, err := models.ParseUserSort(ctx.Query("sort"))
 	if err != nil {
-		slog.Info("GetAllUsers: Failed to retrieve users", "limit", limit, "offset", offset, "error", err)
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		slog.Info("GetAllUsers: Invalid sort", "sort", ctx.Query("sort"), "error", err)
+		return apperr.Validation("Invalid sort")
 	}
+	filter, err := parseUserFilter(ctx)
+	if err != nil {
+		slog.Info("GetAllUsers: Invalid filter", "error", err)
+		return apperr.Validation("Invalid filter")
+	}
+	query := models.UserQuery{Filter: filter, Limit: limit, Offset: offset, Sort: sort}
 
+	keyset := ctx.Context().QueryArgs().Has("cursor")
+	if keyset {
+		if offset != 0 {
+			slog.Info("GetAllUsers: Cursor combined with offset", "offset", offset)
+			return apperr.Validation("Cursor and offset cannot be combined")
+		}
+		if token := ctx.Query("cursor"); token != "" {
+			var after models.UserCursor
+			if err := h.cursors.Decode(token, &after); err != nil || after.Sort != models.SortString(sort) {
+				slog.Info("GetAllUsers: Invalid cursor", "error", err)
+				return apperr.Validation("Invalid cursor")
+			}
+			query.After = &after
+		}
+	}
+
+	users, err := h.userUC.GetAllUsers(ctx.UserContext(), query)
+	if err != nil {
+		slog.Info("GetAllUsers: Failed to retrieve users", "limit", limit, "offset", offset, "error", err)
+		return err
+	}
 	slog.Info("GetAllUsers: Users retrieved", "count", len(users))
-	return ctx.JSON(models.ToResponseList(users))
+
+	base := ctx.BaseURL() + ctx.Path()
+	if keyset {
+		return h.keysetPage(ctx, base, sort, users, limit)
+	}
+
+	count, err := h.userUC.CountUsers(ctx.UserContext(), filter)
+	if err != nil {
+		slog.Info("GetAllUsers: Failed to count users", "error", err)
+		return err
+	}
+	links := offsetLinks(base, requestQuery(ctx), limit, offset, len(users), count)
+	ctx.Set("X-Total-Count", strconv.FormatInt(count.Total, 10))
+	if count.Estimated {
+		ctx.Set("X-Total-Count-Estimated", "true")
+	}
+	ctx.Set(fiber.HeaderLink, links.Header())
+
+	if !envelope {
+		return ctx.JSON(models.ToResponseList(users))
+	}
+	return ctx.JSON(fiber.Map{
+		"users":           models.ToResponseList(users),
+		"total":           count.Total,
+		"total_estimated": count.Estimated,
+		"limit":           limit,
+		"offset":          offset,
+		"next":            orNil(links.Next),
+		"prev":            orNil(links.Prev),
+	})
+}
+
+// keysetPage writes a keyset page with the cursor, and link, to the next one.
+func (h *Handler) keysetPage(ctx *fiber.Ctx, base string, sort []models.SortField, users []*models.User, limit int) error {
+	var next *string
+	if len(users) == limit {
+		token, err := h.cursors.Encode(models.NewUserCursor(sort, users[len(users)-1]))
+		if err != nil {
+			slog.Error("GetAllUsers: Failed to encode cursor", "error", err)
+			return err
+		}
+		next = &token
+		ctx.Set(fiber.HeaderLink, pageLinks{Next: cursorLink(base, requestQuery(ctx), token)}.Header())
+	}
+	return ctx.JSON(fiber.Map{"users": models.ToResponseList(users), "next_cursor": next})
+}
+
+// maxSearchTermLen caps the search term; longer input only costs trigram work.
+const maxSearchTermLen = 100
+
+func (h *Handler) SearchUsers(ctx *fiber.Ctx) error {
+	ctxWithSpan, span := tracing.Start(ctx.UserContext(), "Handler.SearchUsers")
+	defer span.End()
+	ctx.SetUserContext(ctxWithSpan)
+
+	term := strings.TrimSpace(ctx.Query("q"))
+	if term == "" || utf8.RuneCountInString(term) > maxSearchTermLen {
+		slog.Info("SearchUsers: Invalid search term", "q", term)
+		return apperr.Validation("Invalid search term")
+	}
+	limit, err := strconv.Atoi(ctx.Query("limit", "10"))
+	if err != nil || limit <= 0 || limit > 100 {
+		slog.Info("SearchUsers: Invalid limit", "limit", ctx.Query("limit"))
+		return apperr.Validation("Invalid limit")
+	}
+
+	matches, err := h.userUC.SearchUsers(ctx.UserContext(), term, limit)
+	if err != nil {
+		slog.Info("SearchUsers: Failed to search users", "q", term, "error", err)
+		return err
+	}
+
+	slog.Info("SearchUsers: Users found", "count", len(matches))
+	return ctx.JSON(models.ToMatchResponseList(matches))
 }
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"app/internal/apperr"
+	"app/internal/models"
+
+	fiber "github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testUserID = "5f1c9a52-8a47-4f0e-9a3e-0c1f1d1e2b3c"
+
+func putUser(t *testing.T, users *MockUserProvider, id, body, ifMatch string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPut, "/user/"+id, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if ifMatch != "" {
+		req.Header.Set(fiber.HeaderIfMatch, ifMatch)
+	}
+	return serve(t, "/user/:id", (&Handler{userUC: users}).UpsertUser, req)
+}
+
+// upserting matches the user written by an upsert and, on success, gives it
+// the version the repository would.
+func upserting(users *MockUserProvider, id string, age int, version int64) *mock.Call {
+	return users.On("UpsertUser", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
+		return u.ID == id && u.Age == age && u.Version == version
+	})).Once()
+}
+
+func setVersion(version int64) func(mock.Arguments) {
+	return func(args mock.Arguments) { args.Get(1).(*models.User).Version = version }
+}
+
+func TestUpsertUser(t *testing.T) {
+	users := new(MockUserProvider)
+
+	upserting(users, testUserID, 30, 0).Run(setVersion(1)).Return(true, nil)
+	resp := putUser(t, users, strings.ToUpper(testUserID), `{"name":"Ann","age":30}`, "")
+	assert.Equal(t, fiber.StatusCreated, resp.StatusCode, "ids are stored in canonical form")
+	assert.Equal(t, `"1"`, resp.Header.Get(fiber.HeaderETag))
+	assert.Equal(t, "/user/"+testUserID, resp.Header.Get(fiber.HeaderLocation))
+
+	upserting(users, testUserID, 31, 0).Run(setVersion(2)).Return(false, nil)
+	resp = putUser(t, users, testUserID, `{"name":"Ann","age":31}`, "")
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get(fiber.HeaderETag))
+	assert.Empty(t, resp.Header.Get(fiber.HeaderLocation))
+
+	upserting(users, testUserID, 32, 1).Return(false, apperr.ErrPreconditionFailed)
+	resp = putUser(t, users, testUserID, `{"name":"Ann","age":32}`, `"1"`)
+	assert.Equal(t, fiber.StatusPreconditionFailed, resp.StatusCode)
+
+	const otherID = "6a1c9a52-8a47-4f0e-9a3e-0c1f1d1e2b3c"
+	upserting(users, otherID, 40, 1).Return(false, apperr.ErrNotFound)
+	resp = putUser(t, users, otherID, `{"name":"Bob","age":40}`, `"1"`)
+	assert.Equal(t, fiber.StatusPreconditionFailed, resp.StatusCode, "If-Match needs an existing user")
+
+	upserting(users, otherID, 40, models.AnyVersion).Return(false, apperr.ErrNotFound)
+	resp = putUser(t, users, otherID, `{"name":"Bob","age":40}`, "*")
+	assert.Equal(t, fiber.StatusPreconditionFailed, resp.StatusCode, "If-Match: * needs an existing user")
+
+	resp = putUser(t, users, "not-a-uuid", `{"name":"Bob","age":40}`, "")
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	resp = putUser(t, users, testUserID, `{"name":"","age":40}`, "")
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	users.AssertExpectations(t)
+}
+
+func TestUpdateUser_IfMatchAny(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("UpdateUser", mock.Anything, mock.MatchedBy(func(u *models.User) bool {
+		return u.ID == testUserID && u.Version == models.AnyVersion
+	})).Return(apperr.ErrNotFound).Once()
+
+	req := httptest.NewRequest(fiber.MethodPut, "/user", strings.NewReader(`{"id":"`+testUserID+`","name":"Ann","age":30}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderIfMatch, "*")
+	resp := serve(t, "/user", (&Handler{userUC: users}).UpdateUser, req)
+
+	assert.Equal(t, fiber.StatusPreconditionFailed, resp.StatusCode)
+	users.AssertExpectations(t)
+}
+
+func TestDeleteUser_IfMatch(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("DeleteUser", mock.Anything, testUserID, models.AnyVersion).Return(nil).Once()
+	users.On("DeleteUser", mock.Anything, testUserID, models.AnyVersion).Return(apperr.ErrNotFound).Once()
+	users.On("DeleteUser", mock.Anything, testUserID, int64(0)).Return(apperr.ErrNotFound).Once()
+	del := func(ifMatch string) int {
+		req := httptest.NewRequest(fiber.MethodDelete, "/user/"+testUserID, nil)
+		if ifMatch != "" {
+			req.Header.Set(fiber.HeaderIfMatch, ifMatch)
+		}
+		return serve(t, "/user/:id", (&Handler{userUC: users}).DeleteUser, req).StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusNoContent, del("*"))
+	assert.Equal(t, fiber.StatusPreconditionFailed, del("*"), "If-Match: * needs an existing user")
+	assert.Equal(t, fiber.StatusNotFound, del(""))
+	users.AssertExpectations(t)
+}
+
+func TestGetAllUsers_IncludeDeletedOnlyOnAdmin(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("GetAllUsers", mock.Anything, mock.MatchedBy(func(q models.UserQuery) bool {
+		return q.Filter.IncludeDeleted
+	})).Return(nil, nil).Once()
+	users.On("CountUsers", mock.Anything, mock.Anything).Return(models.UserCount{}, nil).Maybe()
+	h := &Handler{userUC: users}
+	get := func(h *Handler) int {
+		return serve(t, "/users", h.GetAllUsers, httptest.NewRequest(fiber.MethodGet, "/users?include_deleted=true", nil)).StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusBadRequest, get(h))
+	assert.Equal(t, fiber.StatusOK, get(h.Admin()))
+	assert.False(t, h.admin, "Admin must not change the public handler")
+	users.AssertExpectations(t)
+}
+
+func searchUsers(t *testing.T, users *MockUserProvider, query string) int {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, "/users/search?"+query, nil)
+	return serve(t, "/users/search", (&Handler{userUC: users}).SearchUsers, req).StatusCode
+}
+
+func TestSearchUsers(t *testing.T) {
+	users := new(MockUserProvider)
+	users.On("SearchUsers", mock.Anything, "ann", 10).Return([]*models.UserMatch{}, nil).Once()
+	users.On("SearchUsers", mock.Anything, "ann", 100).Return([]*models.UserMatch{}, nil).Once()
+
+	assert.Equal(t, fiber.StatusOK, searchUsers(t, users, "q=+ann+"), "the term is trimmed")
+	assert.Equal(t, fiber.StatusOK, searchUsers(t, users, "q=ann&limit=100"))
+	users.AssertExpectations(t)
+}
+
+func TestSearchUsers_InvalidParams(t *testing.T) {
+	longTerm := url.QueryEscape(strings.Repeat("ё", maxSearchTermLen+1))
+	for _, query := range []string{
+		"",
+		"q=",
+		"q=+++",
+		"q=" + longTerm,
+		"q=ann&limit=0",
+		"q=ann&limit=101",
+		"q=ann&limit=x",
+	} {
+		assert.Equal(t, fiber.StatusBadRequest, searchUsers(t, new(MockUserProvider), query), query)
+	}
+
+	users := new(MockUserProvider)
+	users.On("SearchUsers", mock.Anything, strings.Repeat("ё", maxSearchTermLen), 10).Return([]*models.UserMatch{}, nil).Once()
+	assert.Equal(t, fiber.StatusOK, searchUsers(t, users, "q="+url.QueryEscape(strings.Repeat("ё", maxSearchTermLen))),
+		"the length limit counts characters, not bytes")
+	users.AssertExpectations(t)
+}
@@ -17,9 +17,17 @@ var (
 	HttpRequestDuration *prometheus.HistogramVec
 	HttpRequestCount    *prometheus.CounterVec
 
-	cacheHits    prometheus.Counter
-	cacheMisses  prometheus.Counter
-	cacheExpired prometheus.Counter
+	cacheHits              *prometheus.CounterVec
+	cacheMisses            *prometheus.CounterVec
+	cacheExpired           prometheus.Counter
+	cacheCapacityEvictions prometheus.Counter
+	cacheOversized         prometheus.Counter
+
+	cacheNegativeHits   *prometheus.CounterVec
+	cacheNegativeMisses *prometheus.CounterVec
+
+	cacheStaleServed     *prometheus.CounterVec
+	cacheRefreshFailures *prometheus.CounterVec
 )
 
 func Register(ctx context.Context, port string) *prometheus.Registry {
@@ -42,21 +50,53 @@ func Register(ctx context.Context, port string) *prometheus.Registry {
 		[]string{"method", "path", "status"},
 	)
 
-	cacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+	cacheHits = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cache_hits_total",
 		Help: "Total number of cache hits",
-	})
+	}, []string{"entity"})
 
-	cacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+	cacheMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "cache_misses_total",
 		Help: "Total number of cache misses",
-	})
+	}, []string{"entity"})
 
+	// cache_evictions_total has always counted TTL expirations; evictions
+	// made to stay within capacity have their own series.
 	cacheExpired = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "cache_evictions_total",
 		Help: "Total number of evicted entries",
 	})
 
+	cacheCapacityEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cache_capacity_evictions_total",
+		Help: "Total number of entries evicted to stay within cache capacity",
+	})
+
+	cacheOversized = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cache_oversized_total",
+		Help: "Total number of entries not stored because they exceed the cache shard's byte budget",
+	})
+
+	cacheNegativeHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_negative_hits_total",
+		Help: "Total number of lookups answered by a cached not-found result",
+	}, []string{"entity"})
+
+	cacheNegativeMisses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_negative_misses_total",
+		Help: "Total number of repository lookups that found nothing and were cached as not found",
+	}, []string{"entity"})
+
+	cacheStaleServed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_stale_served_total",
+		Help: "Total number of expired entries served while a refresh was pending",
+	}, []string{"entity"})
+
+	cacheRefreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_refresh_failures_total",
+		Help: "Total number of background refreshes that failed to reach the repository",
+	}, []string{"entity"})
+
 	registry.MustRegister(
 		collectors.NewGoCollector(),
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
@@ -65,6 +105,12 @@ func Register(ctx context.Context, port string) *prometheus.Registry {
 		cacheHits,
 		cacheMisses,
 		cacheExpired,
+		cacheCapacityEvictions,
+		cacheOversized,
+		cacheNegativeHits,
+		cacheNegativeMisses,
+		cacheStaleServed,
+		cacheRefreshFailures,
 	)
 
 	go runServer(ctx, port, registry)
@@ -77,18 +123,42 @@ func ObserveHttpRequest(method, path string, status int, duration float64) {
 	HttpRequestCount.WithLabelValues(method, path, strconv.Itoa(status)).Inc()
 }
 
-func IncCacheHits() {
-	cacheHits.Inc()
+func IncCacheHits(entity string) {
+	cacheHits.WithLabelValues(entity).Inc()
 }
 
-func IncCacheMisses() {
-	cacheMisses.Inc()
+func IncCacheMisses(entity string) {
+	cacheMisses.WithLabelValues(entity).Inc()
 }
 
 func IncCacheExpired() {
 	cacheExpired.Inc()
 }
 
+func IncCacheCapacityEvictions() {
+	cacheCapacityEvictions.Inc()
+}
+
+func IncCacheOversized() {
+	cacheOversized.Inc()
+}
+
+func IncCacheNegativeHits(entity string) {
+	cacheNegativeHits.WithLabelValues(entity).Inc()
+}
+
+func IncCacheNegativeMisses(entity string) {
+	cacheNegativeMisses.WithLabelValues(entity).Inc()
+}
+
+func IncCacheStaleServed(entity string) {
+	cacheStaleServed.WithLabelValues(entity).Inc()
+}
+
+func IncCacheRefreshFailures(entity string) {
+	cacheRefreshFailures.WithLabelValues(entity).Inc()
+}
+
 func runServer(ctx context.Context, port string, reg *prometheus.Registry) {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
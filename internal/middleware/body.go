@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"io"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit caps request bodies at limit bytes. With StreamRequestBody
+// enabled fiber no longer rejects oversized bodies itself, so every path
+// except the streaming ones listed in stream is read here, up to the limit.
+func BodyLimit(limit int, stream ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if slices.Contains(stream, c.Path()) {
+			return c.Next()
+		}
+
+		req := c.Request()
+		if req.Header.ContentLength() > limit {
+			return tooLarge(c)
+		}
+		if bs := req.BodyStream(); bs != nil {
+			body, err := io.ReadAll(io.LimitReader(bs, int64(limit)+1))
+			_ = req.CloseBodyStream()
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Failed to read request body")
+			}
+			if len(body) > limit {
+				return tooLarge(c)
+			}
+			req.SetBody(body)
+		}
+		return c.Next()
+	}
+}
+
+// tooLarge rejects the request and closes the connection, since the rest of
+// the body is left unread on it.
+func tooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Request body too large")
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"time"
+
+	"app/internal/apperr"
+	"app/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed marks a response replayed from the store.
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLen caps the keys clients may send.
+const maxIdempotencyKeyLen = 255
+
+// IdempotencyStore keeps the keys. Reserve hands out a token identifying
+// the caller's reservation; Complete and Release only act on a key still
+// held under that token.
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key string, fingerprint []byte) (*models.IdempotencyRecord, time.Time, error)
+	Complete(ctx context.Context, key string, token time.Time, status int, contentType string, body []byte) error
+	Release(ctx context.Context, key string, token time.Time) error
+}
+
+// Idempotency makes requests carrying an Idempotency-Key safe to retry. The
+// first request with a key is handled and, if it succeeds, its response is
+// stored; later requests with the key get that response replayed. Reusing a
+// key for a different request is a 422, and a retry while the first request
+// is still running a 409. Failed requests free the key.
+func Idempotency(store IdempotencyStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Copied: c.Get aliases the request buffer and a store may keep the key.
+		key := utils.CopyString(c.Get(HeaderIdempotencyKey))
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			return apperr.Validation("Idempotency-Key is too long")
+		}
+
+		fingerprint := requestFingerprint(c)
+		rec, token, err := store.Reserve(c.UserContext(), key, fingerprint)
+		switch {
+		case err != nil:
+			return err
+		case rec == nil:
+		case !bytes.Equal(rec.Fingerprint, fingerprint):
+			slog.Info("Idempotency: Key reused for a different request", "path", c.Path())
+			return apperr.Unprocessable("Idempotency-Key was used with a different request")
+		case rec.Status == 0:
+			slog.Info("Idempotency: Key in use", "path", c.Path())
+			return apperr.Conflict("A request with this Idempotency-Key is in progress")
+		default:
+			slog.Info("Idempotency: Replaying response", "path", c.Path(), "status", rec.Status)
+			c.Set(HeaderIdempotentReplayed, "true")
+			c.Set(fiber.HeaderContentType, rec.ContentType)
+			return c.Status(rec.Status).Send(rec.Body)
+		}
+
+		err = c.Next()
+		resp := c.Response()
+		if err != nil || resp.StatusCode() >= fiber.StatusBadRequest {
+			if err := store.Release(c.UserContext(), key, token); err != nil {
+				slog.Error("Idempotency: Failed to release key", "path", c.Path(), "error", err)
+			}
+			return err
+		}
+		// The request has succeeded; a failure here, also when the
+		// reservation was taken over, only means it is not replayed.
+		if err := store.Complete(c.UserContext(), key, token, resp.StatusCode(), string(resp.Header.ContentType()), resp.Body()); err != nil {
+			slog.Error("Idempotency: Failed to store response", "path", c.Path(), "error", err)
+		}
+		return nil
+	}
+}
+
+// requestFingerprint hashes what makes two requests the same one.
+func requestFingerprint(c *fiber.Ctx) []byte {
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+	h.Write(c.Body())
+	return h.Sum(nil)
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"app/internal/handler"
+	"app/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryKeys struct {
+	records map[string]*models.IdempotencyRecord
+	tokens  map[string]time.Time
+}
+
+func newMemoryKeys() *memoryKeys {
+	return &memoryKeys{records: map[string]*models.IdempotencyRecord{}, tokens: map[string]time.Time{}}
+}
+
+func (m *memoryKeys) Reserve(_ context.Context, key string, fingerprint []byte) (*models.IdempotencyRecord, time.Time, error) {
+	if rec, ok := m.records[key]; ok {
+		return rec, time.Time{}, nil
+	}
+	m.records[key] = &models.IdempotencyRecord{Fingerprint: fingerprint}
+	m.tokens[key] = time.Now()
+	return nil, m.tokens[key], nil
+}
+
+// takeOver hands the reservation of key to another request, as a lapsed
+// lease would.
+func (m *memoryKeys) takeOver(key string) {
+	m.tokens[key] = m.tokens[key].Add(time.Minute)
+}
+
+func (m *memoryKeys) Complete(_ context.Context, key string, token time.Time, status int, contentType string, body []byte) error {
+	rec := m.records[key]
+	if rec == nil || rec.Status != 0 || !m.tokens[key].Equal(token) {
+		return errors.New("reservation lost")
+	}
+	rec.Status, rec.ContentType, rec.Body = status, contentType, append([]byte(nil), body...)
+	return nil
+}
+
+func (m *memoryKeys) Release(_ context.Context, key string, token time.Time) error {
+	if rec := m.records[key]; rec != nil && rec.Status == 0 && m.tokens[key].Equal(token) {
+		delete(m.records, key)
+	}
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	keys := newMemoryKeys()
+	calls := 0
+	fail := false
+	app := fiber.New(fiber.Config{ErrorHandler: handler.ErrorHandler})
+	app.Post("/user", Idempotency(keys), func(c *fiber.Ctx) error {
+		calls++
+		if fail {
+			return fiber.ErrServiceUnavailable
+		}
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"id": calls})
+	})
+
+	post := func(key, body string) (int, string, string) {
+		req := httptest.NewRequest(fiber.MethodPost, "/user", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		if key != "" {
+			req.Header.Set(HeaderIdempotencyKey, key)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header.Get(HeaderIdempotentReplayed), string(data)
+	}
+
+	status, replayed, body := post("k1", `{"name":"Ann"}`)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Empty(t, replayed)
+	assert.JSONEq(t, `{"id":1}`, body)
+
+	status, replayed, body = post("k1", `{"name":"Ann"}`)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, "true", replayed)
+	assert.JSONEq(t, `{"id":1}`, body)
+	assert.Equal(t, 1, calls)
+
+	status, _, _ = post("k1", `{"name":"Bob"}`)
+	assert.Equal(t, fiber.StatusUnprocessableEntity, status)
+	assert.Equal(t, 1, calls)
+
+	keys.records["k1"].Status = 0
+	status, _, _ = post("k1", `{"name":"Ann"}`)
+	assert.Equal(t, fiber.StatusConflict, status)
+
+	fail = true
+	status, _, _ = post("k2", `{"name":"Cid"}`)
+	assert.Equal(t, fiber.StatusServiceUnavailable, status)
+	assert.NotContains(t, keys.records, "k2")
+
+	fail = false
+	status, _, _ = post("k2", `{"name":"Cid"}`)
+	assert.Equal(t, fiber.StatusCreated, status)
+
+	post("", `{"name":"Ann"}`)
+	post("", `{"name":"Ann"}`)
+	assert.Equal(t, 5, calls)
+}
+
+func TestIdempotency_TakenOverReservation(t *testing.T) {
+	keys := newMemoryKeys()
+	app := fiber.New(fiber.Config{ErrorHandler: handler.ErrorHandler})
+	fail := false
+	app.Post("/user", Idempotency(keys), func(c *fiber.Ctx) error {
+		// The lease lapses while the request runs and a retry takes the key.
+		keys.takeOver("k1")
+		if fail {
+			return fiber.ErrServiceUnavailable
+		}
+		return c.SendStatus(fiber.StatusCreated)
+	})
+	post := func() int {
+		req := httptest.NewRequest(fiber.MethodPost, "/user", strings.NewReader(`{}`))
+		req.Header.Set(HeaderIdempotencyKey, "k1")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, fiber.StatusCreated, post())
+	assert.Zero(t, keys.records["k1"].Status, "a stale holder must not complete the new reservation")
+
+	delete(keys.records, "k1")
+	fail = true
+	assert.Equal(t, fiber.StatusServiceUnavailable, post())
+	assert.Contains(t, keys.records, "k1", "a stale holder must not release the new reservation")
+}
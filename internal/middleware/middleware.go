@@ -15,7 +15,12 @@ func Middleware() fiber.Handler {
 		}
 
 		start := time.Now()
-		err := c.Next()
+		if err := c.Next(); err != nil {
+			// Write the error response now so its status is the one recorded.
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				return err
+			}
+		}
 		duration := time.Since(start).Seconds()
 		status := c.Response().StatusCode()
 
@@ -26,6 +31,6 @@ func Middleware() fiber.Handler {
 
 		metrics.ObserveHttpRequest(c.Method(), path, status, duration)
 
-		return err
+		return nil
 	}
 }
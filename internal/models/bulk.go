@@ -0,0 +1,32 @@
+package models
+
+import "github.com/pkg/errors"
+
+// BulkMode decides what happens to a bulk request when some items fail.
+type BulkMode string
+
+const (
+	// BulkAtomic applies every item or none.
+	BulkAtomic BulkMode = "atomic"
+	// BulkBestEffort applies every item that can be applied.
+	BulkBestEffort BulkMode = "best_effort"
+)
+
+// ParseBulkMode validates a mode name. An empty name selects BulkAtomic.
+func ParseBulkMode(name string) (BulkMode, error) {
+	switch mode := BulkMode(name); mode {
+	case "":
+		return BulkAtomic, nil
+	case BulkAtomic, BulkBestEffort:
+		return mode, nil
+	default:
+		return "", errors.Errorf("unknown bulk mode %q", name)
+	}
+}
+
+// BulkResult is the outcome of one item of a bulk request. Err is nil when
+// the item was applied.
+type BulkResult struct {
+	ID  string
+	Err error
+}
@@ -0,0 +1,11 @@
+package models
+
+// IdempotencyRecord is what is stored for an Idempotency-Key.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request the key was first used with.
+	Fingerprint []byte
+	// Status is zero while that request is still being handled.
+	Status      int
+	ContentType string
+	Body        []byte
+}
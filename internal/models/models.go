@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	validator "github.com/go-playground/validator/v10"
 )
 
@@ -10,27 +12,40 @@ func Validate(data interface{}) error {
 	return validate.Struct(data)
 }
 
+// AnyVersion is the version of a write conditional only on the user
+// existing, as asked for by If-Match: *.
+const AnyVersion int64 = -2
+
 type User struct {
 	ID   string `json:"id"`
 	Name string `json:"name"`
 	Age  int    `json:"age"`
+	// Version counts the writes to the user; it is exposed as its ETag.
+	// Zero means unknown, e.g. in a request that carries no precondition.
+	Version int64 `json:"version"`
+	// DeletedAt is set while the user is soft-deleted. Only listings that
+	// include deleted users return such users.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// Age has no required rule in the requests: required rejects the zero value,
+// and 0 is a valid age.
 type CreateUserRequest struct {
 	Name string `json:"name" validate:"required"`
-	Age  int    `json:"age" validate:"required,gte=0,lte=150"`
+	Age  int    `json:"age" validate:"gte=0,lte=150"`
 }
 
 type UpdateUserRequest struct {
 	ID   string `json:"id" validate:"required,uuid4"`
 	Name string `json:"name" validate:"required"`
-	Age  int    `json:"age" validate:"required,gte=0,lte=150"`
+	Age  int    `json:"age" validate:"gte=0,lte=150"`
 }
 
 type UserResponse struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Age  int    `json:"age"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Age       int        `json:"age"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 func ToEntityFromCreate(req CreateUserRequest) User {
@@ -41,21 +56,25 @@ func ToEntityFromCreate(req CreateUserRequest) User {
 }
 
 func ToEntityFromUpdate(req UpdateUserRequest) User {
-	// return User{
-	//	ID:   req.ID,
-	//	Name: req.Name,
-	//	Age:  req.Age,
-	//}
-	return User(req)
+	return User{
+		ID:   req.ID,
+		Name: req.Name,
+		Age:  req.Age,
+	}
+}
+
+// AtVersion reports whether a write conditional on version may replace u.
+func (u User) AtVersion(version int64) bool {
+	return version == 0 || version == AnyVersion || u.Version == version
 }
 
 func (u User) ToResponse() UserResponse {
-	// return UserResponse{
-	//	ID:   u.ID,
-	//	Name: u.Name,
-	//	Age:  u.Age,
-	//}
-	return UserResponse(u)
+	return UserResponse{
+		ID:        u.ID,
+		Name:      u.Name,
+		Age:       u.Age,
+		DeletedAt: u.DeletedAt,
+	}
 }
 
 func ToResponseList(users []*User) []UserResponse {
@@ -0,0 +1,25 @@
+package models
+
+// UserPatch lists the fields a partial update changes; nil fields are left
+// as they are.
+type UserPatch struct {
+	Name *string
+	Age  *int
+}
+
+// IsEmpty reports whether the patch changes nothing.
+func (p UserPatch) IsEmpty() bool {
+	return p.Name == nil && p.Age == nil
+}
+
+// Diff returns the patch that turns u into next.
+func (u User) Diff(next User) UserPatch {
+	var p UserPatch
+	if next.Name != u.Name {
+		p.Name = &next.Name
+	}
+	if next.Age != u.Age {
+		p.Age = &next.Age
+	}
+	return p
+}
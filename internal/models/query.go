@@ -0,0 +1,173 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// userSortFields whitelists the fields users can be sorted and paged on.
+var userSortFields = map[string]bool{
+	"id":   true,
+	"name": true,
+	"age":  true,
+}
+
+// SortField orders users by one field.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+func (f SortField) String() string {
+	if f.Desc {
+		return "-" + f.Field
+	}
+	return f.Field
+}
+
+// ParseUserSort parses a comma separated list of sort keys such as
+// "name,-age", where a leading "-" sorts descending. An empty spec sorts by
+// id.
+func ParseUserSort(spec string) ([]SortField, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(spec, ",")
+	sort := make([]SortField, 0, len(parts))
+	seen := make(map[string]bool, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		field := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if !userSortFields[field.Field] {
+			return nil, errors.Errorf("cannot sort users by %q", field.Field)
+		}
+		if seen[field.Field] {
+			return nil, errors.Errorf("users sorted by %q twice", field.Field)
+		}
+		seen[field.Field] = true
+		sort = append(sort, field)
+	}
+	return sort, nil
+}
+
+// SortString renders sort in the form ParseUserSort accepts. It is the
+// normalized form used in cursors and cache keys.
+func SortString(sort []SortField) string {
+	if len(sort) == 0 {
+		return "id"
+	}
+	parts := make([]string, len(sort))
+	for i, f := range sort {
+		parts[i] = f.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// UserFilter narrows a listing. Zero fields do not filter.
+type UserFilter struct {
+	// NamePrefix and NameContains match names case-insensitively.
+	NamePrefix   string
+	NameContains string
+	AgeMin       *int
+	AgeMax       *int
+	// IncludeDeleted lists soft-deleted users too.
+	IncludeDeleted bool
+}
+
+// Validate checks that the age bounds are in range and ordered.
+func (f UserFilter) Validate() error {
+	for _, age := range []*int{f.AgeMin, f.AgeMax} {
+		if age != nil && (*age < 0 || *age > 150) {
+			return errors.Errorf("age bound %d out of range", *age)
+		}
+	}
+	if f.AgeMin != nil && f.AgeMax != nil && *f.AgeMin > *f.AgeMax {
+		return errors.New("age_min is greater than age_max")
+	}
+	return nil
+}
+
+// String renders f in a normalized form, for cache keys.
+func (f UserFilter) String() string {
+	bound := func(age *int) string {
+		if age == nil {
+			return ""
+		}
+		return fmt.Sprint(*age)
+	}
+	return fmt.Sprintf("%q:%q:%s:%s:%t", f.NamePrefix, f.NameContains, bound(f.AgeMin), bound(f.AgeMax), f.IncludeDeleted)
+}
+
+// UserQuery selects a page of users. A page starts either at Offset or, for
+// keyset paging, right after the user After points at.
+type UserQuery struct {
+	Filter UserFilter
+	Limit  int
+	Offset int
+	Sort   []SortField
+	After  *UserCursor
+}
+
+// CacheKey identifies the page q selects.
+func (q UserQuery) CacheKey() string {
+	key := fmt.Sprintf("%d:%d:%s:%s", q.Limit, q.Offset, SortString(q.Sort), q.Filter)
+	if q.After != nil {
+		key += fmt.Sprintf(":%s:%q:%d", q.After.ID, q.After.Name, q.After.Age)
+	}
+	return key
+}
+
+// UserMatch is a search result with its relevance, higher is better.
+type UserMatch struct {
+	User  *User
+	Score float64
+}
+
+type UserMatchResponse struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Age   int     `json:"age"`
+	Score float64 `json:"score"`
+}
+
+func ToMatchResponseList(matches []*UserMatch) []UserMatchResponse {
+	res := make([]UserMatchResponse, len(matches))
+	for i, m := range matches {
+		res[i] = UserMatchResponse{ID: m.User.ID, Name: m.User.Name, Age: m.User.Age, Score: m.Score}
+	}
+	return res
+}
+
+// UserCount is the number of users matching a filter. Estimated counts come
+// from planner statistics and may be off by a few percent.
+type UserCount struct {
+	Total     int64 `json:"total"`
+	Estimated bool  `json:"estimated"`
+}
+
+// UserCursor is the position after the last user of a page: the values it
+// was sorted on, its id as a tiebreaker, and the sort they were taken under.
+type UserCursor struct {
+	Sort string `json:"s"`
+	ID   string `json:"id"`
+	Name string `json:"n,omitempty"`
+	Age  int    `json:"a,omitempty"`
+}
+
+// NewUserCursor points just after last in a listing sorted by sort.
+func NewUserCursor(sort []SortField, last *User) UserCursor {
+	c := UserCursor{Sort: SortString(sort), ID: last.ID}
+	for _, f := range sort {
+		switch f.Field {
+		case "name":
+			c.Name = last.Name
+		case "age":
+			c.Age = last.Age
+		}
+	}
+	return c
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUserSort(t *testing.T) {
+	sort, err := ParseUserSort("")
+	require.NoError(t, err)
+	assert.Empty(t, sort)
+	assert.Equal(t, "id", SortString(sort))
+
+	sort, err = ParseUserSort("-age")
+	require.NoError(t, err)
+	assert.Equal(t, []SortField{{Field: "age", Desc: true}}, sort)
+	assert.Equal(t, "-age", SortString(sort))
+
+	sort, err = ParseUserSort("name, -age")
+	require.NoError(t, err)
+	assert.Equal(t, []SortField{{Field: "name"}, {Field: "age", Desc: true}}, sort)
+	assert.Equal(t, "name,-age", SortString(sort))
+
+	for _, bad := range []string{"password", "name,name", "name,", "--age"} {
+		_, err = ParseUserSort(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestUserFilter_Validate(t *testing.T) {
+	age := func(n int) *int { return &n }
+
+	assert.NoError(t, UserFilter{}.Validate())
+	assert.NoError(t, UserFilter{AgeMin: age(18), AgeMax: age(18)}.Validate())
+	assert.Error(t, UserFilter{AgeMin: age(-1)}.Validate())
+	assert.Error(t, UserFilter{AgeMax: age(151)}.Validate())
+	assert.Error(t, UserFilter{AgeMin: age(30), AgeMax: age(20)}.Validate())
+}
+
+func TestNewUserCursor(t *testing.T) {
+	last := &User{ID: "1", Name: "Alice", Age: 30}
+
+	assert.Equal(t, UserCursor{Sort: "id", ID: "1"}, NewUserCursor(nil, last))
+	assert.Equal(t, UserCursor{Sort: "name", ID: "1", Name: "Alice"},
+		NewUserCursor([]SortField{{Field: "name"}}, last))
+}
+
+func TestUserQuery_CacheKey(t *testing.T) {
+	byID := UserQuery{Limit: 10}
+	byName := UserQuery{Limit: 10, Sort: []SortField{{Field: "name"}}}
+	after := UserQuery{Limit: 10, After: &UserCursor{Sort: "id", ID: "1"}}
+
+	assert.NotEqual(t, byID.CacheKey(), byName.CacheKey())
+	assert.NotEqual(t, byID.CacheKey(), after.CacheKey())
+	assert.Equal(t, byID.CacheKey(), UserQuery{Limit: 10, Sort: []SortField{}}.CacheKey())
+
+	minAge := 0
+	filtered := UserQuery{Limit: 10, Filter: UserFilter{AgeMin: &minAge}}
+	prefix := UserQuery{Limit: 10, Filter: UserFilter{NamePrefix: "a"}}
+	contains := UserQuery{Limit: 10, Filter: UserFilter{NameContains: "a"}}
+	assert.NotEqual(t, byID.CacheKey(), filtered.CacheKey(), "a zero bound still filters")
+	assert.NotEqual(t, prefix.CacheKey(), contains.CacheKey())
+}
+
+func TestParseBulkMode(t *testing.T) {
+	mode, err := ParseBulkMode("")
+	require.NoError(t, err)
+	assert.Equal(t, BulkAtomic, mode)
+
+	mode, err = ParseBulkMode("best_effort")
+	require.NoError(t, err)
+	assert.Equal(t, BulkBestEffort, mode)
+
+	_, err = ParseBulkMode("partial")
+	assert.Error(t, err)
+}
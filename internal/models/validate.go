@@ -0,0 +1,75 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
+	validator "github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	rutranslations "github.com/go-playground/validator/v10/translations/ru"
+)
+
+// Languages lists the languages validation messages are available in. The
+// first one is the fallback.
+var Languages = []string{"en", "ru"}
+
+// Rules reported for fields a request has that fail to decode rather than
+// to validate.
+const (
+	RuleType    = "type"
+	RuleUnknown = "unknown"
+)
+
+// decodeMessages are the messages of the decoding rules, which the
+// validator has no translations for.
+var decodeMessages = map[string]map[string]string{
+	"en": {
+		RuleType:    "{0} has the wrong type",
+		RuleUnknown: "{0} is not a known field",
+	},
+	"ru": {
+		RuleType:    "{0} имеет неверный тип",
+		RuleUnknown: "{0} не является известным полем",
+	},
+}
+
+var translators *ut.UniversalTranslator
+
+func init() {
+	// Report fields by their JSON names, as the client sent them.
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	english := en.New()
+	translators = ut.New(english, english, ru.New())
+	register := map[string]func(*validator.Validate, ut.Translator) error{
+		"en": entranslations.RegisterDefaultTranslations,
+		"ru": rutranslations.RegisterDefaultTranslations,
+	}
+	for lang, fn := range register {
+		trans, _ := translators.GetTranslator(lang)
+		if err := fn(validate, trans); err != nil {
+			panic(err)
+		}
+		for rule, text := range decodeMessages[lang] {
+			if err := trans.Add(rule, text, false); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+// Translator returns the validation message translator for lang, or the
+// English one when there is none.
+func Translator(lang string) ut.Translator {
+	trans, _ := translators.FindTranslator(lang)
+	return trans
+}
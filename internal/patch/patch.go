@@ -0,0 +1,321 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values decoded with encoding/json.
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInvalid means the patch document itself is malformed.
+	ErrInvalid = errors.New("invalid patch")
+	// ErrConflict means a well-formed patch cannot be applied to the
+	// document, e.g. a path does not exist or a test operation failed.
+	ErrConflict = errors.New("patch does not apply")
+)
+
+// Merge returns target with the merge patch applied. target is not
+// modified.
+func Merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	} else {
+		t = clone(t).(map[string]any)
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = Merge(t[key], value)
+		}
+	}
+	return t
+}
+
+// Operation is one JSON Patch operation. Value is nil when the member is
+// absent, which is different from a JSON null.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+
+	path, from []string
+	value      any
+}
+
+// Decode parses a JSON Patch document and checks every operation is
+// well-formed.
+func Decode(data []byte) ([]Operation, error) {
+	var ops []Operation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, errors.Wrap(ErrInvalid, err.Error())
+	}
+	for i := range ops {
+		if err := ops[i].prepare(); err != nil {
+			return nil, errors.Wrapf(err, "operation %d", i)
+		}
+	}
+	return ops, nil
+}
+
+func (op *Operation) prepare() error {
+	var err error
+	if op.path, err = parsePointer(op.Path); err != nil {
+		return err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return errors.Wrapf(ErrInvalid, "%s needs a value", op.Op)
+		}
+		if err := json.Unmarshal(op.Value, &op.value); err != nil {
+			return errors.Wrap(ErrInvalid, err.Error())
+		}
+	case "move", "copy":
+		if op.from, err = parsePointer(op.From); err != nil {
+			return err
+		}
+		if op.Op == "move" && len(op.from) < len(op.path) && isPrefix(op.from, op.path) {
+			return errors.Wrap(ErrInvalid, "cannot move a value into itself")
+		}
+	case "remove":
+	default:
+		return errors.Wrapf(ErrInvalid, "unknown op %q", op.Op)
+	}
+	return nil
+}
+
+// Apply returns doc with ops applied in order. The operations are all or
+// nothing and doc is not modified.
+func Apply(doc any, ops []Operation) (any, error) {
+	doc = clone(doc)
+	for i, op := range ops {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, errors.Wrapf(err, "operation %d (%s %s)", i, op.Op, op.Path)
+		}
+	}
+	return doc, nil
+}
+
+func (op *Operation) apply(doc any) (any, error) {
+	switch op.Op {
+	case "add":
+		return add(doc, op.path, clone(op.value))
+	case "remove":
+		doc, _, err := remove(doc, op.path)
+		return doc, err
+	case "replace":
+		doc, _, err := remove(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, clone(op.value))
+	case "move":
+		doc, value, err := remove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case "copy":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, clone(value))
+	case "test":
+		value, err := get(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, op.value) {
+			return nil, errors.Wrap(ErrConflict, "test failed")
+		}
+		return doc, nil
+	}
+	return nil, errors.Wrapf(ErrInvalid, "unknown op %q", op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, errors.Wrapf(ErrInvalid, "pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, tokens []string) bool {
+	for i := range prefix {
+		if prefix[i] != tokens[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func get(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, errors.Wrapf(ErrConflict, "no member %q", token)
+			}
+			doc = value
+		case []any:
+			i, err := index(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, errors.Wrapf(ErrConflict, "cannot descend into %q", token)
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at tokens, inserting into arrays, and returns the
+// updated doc.
+func add(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return update(doc, tokens, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			i := len(node)
+			if token != "-" {
+				var err error
+				if i, err = index(token, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, errors.Wrapf(ErrConflict, "cannot add %q to a scalar", token)
+		}
+	})
+}
+
+// remove deletes the value at tokens and returns the updated doc and the
+// removed value.
+func remove(doc any, tokens []string) (any, any, error) {
+	if len(tokens) == 0 {
+		return nil, nil, errors.Wrap(ErrConflict, "cannot remove the whole document")
+	}
+	var removed any
+	doc, err := update(doc, tokens, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, errors.Wrapf(ErrConflict, "no member %q", token)
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []any:
+			i, err := index(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, errors.Wrapf(ErrConflict, "cannot remove %q from a scalar", token)
+		}
+	})
+	return doc, removed, err
+}
+
+// update walks to the parent of the last token, lets fn change it, and
+// stores the result back, since changing an array may reallocate it.
+func update(doc any, tokens []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	token := tokens[0]
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, errors.Wrapf(ErrConflict, "no member %q", token)
+		}
+		child, err := update(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []any:
+		i, err := index(token, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(node[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, errors.Wrapf(ErrConflict, "cannot descend into %q", token)
+	}
+}
+
+// index parses an array index token that must not exceed max.
+func index(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, errors.Wrapf(ErrConflict, "invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max {
+		return 0, errors.Wrapf(ErrConflict, "array index %q out of range", token)
+	}
+	return i, nil
+}
+
+// clone deep-copies a decoded JSON value.
+func clone(v any) any {
+	switch node := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(node))
+		for key, value := range node {
+			c[key] = clone(value)
+		}
+		return c
+	case []any:
+		c := make([]any, len(node))
+		for i, value := range node {
+			c[i] = clone(value)
+		}
+		return c
+	default:
+		return v
+	}
+}
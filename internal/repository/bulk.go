@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+
+	"app/internal/apperr"
+	"app/internal/models"
+	"app/internal/tracing"
+
+	"github.com/google/uuid"
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+)
+
+// initialVersion is the version the users table gives new rows.
+const initialVersion = 1
+
+// bulkStatement is one item of a bulk write. check turns a successful
+// command tag into the item's outcome, e.g. ErrNotFound for zero rows.
+type bulkStatement struct {
+	sql   string
+	args  []any
+	check func(pgconn.CommandTag) error
+}
+
+func requireRow(tag pgconn.CommandTag) error {
+	if tag.RowsAffected() == 0 {
+		return apperr.ErrNotFound
+	}
+	return nil
+}
+
+// CreateMany inserts users with COPY, assigning each a new id. In best
+// effort mode a failed COPY falls back to inserting row by row, so one bad
+// row does not fail the others. Users that were not inserted are left
+// without an id, and so are their results.
+func (r *UserRepo) CreateMany(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	ctx, span := tracing.Start(ctx, "Repository.CreateUsers")
+	defer span.End()
+
+	rows := make([][]any, len(users))
+	for i, user := range users {
+		user.ID = uuid.New().String()
+		rows[i] = []any{user.ID, user.Name, user.Age}
+	}
+	copyRows := func(ctx context.Context, db interface {
+		CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error)
+	}) error {
+		_, err := db.CopyFrom(ctx, pgx.Identifier{"users"}, []string{"id", "name", "age"}, pgx.CopyFromRows(rows))
+		return err
+	}
+
+	var err error
+	if mode == models.BulkAtomic {
+		err = pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+			return copyRows(ctx, tx)
+		})
+	} else {
+		err = copyRows(ctx, r.db)
+	}
+	if err == nil {
+		slog.Info("CreateMany: Users created", "count", len(users))
+		results := make([]models.BulkResult, len(users))
+		for i, user := range users {
+			user.Version = initialVersion
+			results[i] = models.BulkResult{ID: user.ID}
+		}
+		return results, nil
+	}
+
+	var pgErr *pgconn.PgError
+	if mode == models.BulkAtomic || !errors.As(err, &pgErr) {
+		slog.Error("CreateMany: Failed to copy users", "count", len(users), "error", err)
+		for _, user := range users {
+			user.ID = ""
+		}
+		return nil, dbError(err, "failed to create users")
+	}
+
+	slog.Warn("CreateMany: COPY failed, inserting row by row", "count", len(users), "error", err)
+	stmts := make([]bulkStatement, len(users))
+	for i, user := range users {
+		stmts[i] = bulkStatement{
+			sql:  "INSERT INTO users (id, name, age) VALUES ($1, $2, $3)",
+			args: []any{user.ID, user.Name, user.Age},
+		}
+	}
+	results, err := r.runBulk(ctx, stmts, ids(users), mode)
+	if err != nil {
+		for _, user := range users {
+			user.ID = ""
+		}
+		return nil, err
+	}
+	for i, res := range results {
+		if res.Err == nil {
+			users[i].Version = initialVersion
+		} else {
+			users[i].ID, results[i].ID = "", ""
+		}
+	}
+	return results, nil
+}
+
+// UpdateMany updates users in one pipelined batch. Versions are not checked
+// and the new ones are not read back.
+func (r *UserRepo) UpdateMany(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	ctx, span := tracing.Start(ctx, "Repository.UpdateUsers")
+	defer span.End()
+
+	stmts := make([]bulkStatement, len(users))
+	for i, user := range users {
+		stmts[i] = bulkStatement{
+			sql:   "UPDATE users SET name=$1, age=$2 WHERE id=$3 AND deleted_at IS NULL",
+			args:  []any{user.Name, user.Age, user.ID},
+			check: requireRow,
+		}
+	}
+	return r.runBulk(ctx, stmts, ids(users), mode)
+}
+
+// DeleteMany soft-deletes users in one pipelined batch.
+func (r *UserRepo) DeleteMany(ctx context.Context, userIDs []string, mode models.BulkMode) ([]models.BulkResult, error) {
+	ctx, span := tracing.Start(ctx, "Repository.DeleteUsers")
+	defer span.End()
+
+	stmts := make([]bulkStatement, len(userIDs))
+	for i, id := range userIDs {
+		stmts[i] = bulkStatement{
+			sql:   "UPDATE users SET deleted_at = now() WHERE id=$1 AND deleted_at IS NULL",
+			args:  []any{id},
+			check: requireRow,
+		}
+	}
+	return r.runBulk(ctx, stmts, userIDs, mode)
+}
+
+func ids(users []*models.User) []string {
+	res := make([]string, len(users))
+	for i, user := range users {
+		res[i] = user.ID
+	}
+	return res
+}
+
+// runBulk executes stmts and reports an outcome per statement. The returned
+// error is reserved for failures that are not about any one item.
+func (r *UserRepo) runBulk(ctx context.Context, stmts []bulkStatement, keys []string, mode models.BulkMode) ([]models.BulkResult, error) {
+	var (
+		errs []error
+		err  error
+	)
+	if mode == models.BulkAtomic {
+		errs, err = r.runAtomic(ctx, stmts)
+	} else {
+		errs, err = r.runBestEffort(ctx, stmts)
+	}
+	if err != nil {
+		slog.Error("Bulk: Batch failed", "count", len(stmts), "error", err)
+		return nil, dbError(err, "bulk write failed")
+	}
+
+	results := make([]models.BulkResult, len(stmts))
+	failed := 0
+	for i := range stmts {
+		results[i] = models.BulkResult{ID: keys[i], Err: errs[i]}
+		if errs[i] != nil {
+			failed++
+		}
+	}
+	slog.Info("Bulk: Batch applied", "count", len(stmts), "failed", failed, "mode", mode)
+	return results, nil
+}
+
+// runAtomic runs the batch in a transaction that is rolled back as soon as
+// one statement fails; every other statement is then reported as aborted.
+func (r *UserRepo) runAtomic(ctx context.Context, stmts []bulkStatement) ([]error, error) {
+	errs := make([]error, len(stmts))
+	failed := false
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		for _, stmt := range stmts {
+			batch.Queue(stmt.sql, stmt.args...)
+		}
+		br := tx.SendBatch(ctx, batch)
+		for i, stmt := range stmts {
+			tag, err := br.Exec()
+			if err != nil {
+				var pgErr *pgconn.PgError
+				if !errors.As(err, &pgErr) {
+					_ = br.Close()
+					return err
+				}
+				errs[i] = err
+				failed = true
+				break
+			}
+			if stmt.check != nil {
+				if errs[i] = stmt.check(tag); errs[i] != nil {
+					failed = true
+				}
+			}
+		}
+		if err := br.Close(); err != nil && !failed {
+			return err
+		}
+		if failed {
+			return apperr.ErrAborted
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, apperr.ErrAborted) {
+		return nil, err
+	}
+	if failed {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = apperr.ErrAborted
+			}
+		}
+	}
+	return errs, nil
+}
+
+// bestEffortWindow caps how many statements runBestEffort pipelines at a
+// time, and so how many it sends again after a failure.
+const bestEffortWindow = 500
+
+// runBestEffort runs the batch in one transaction with a savepoint around
+// every statement, so a failing statement is rolled back on its own and the
+// ones before it are kept. Statements are pipelined; the server skips the
+// rest of a pipeline after a failure, so those are sent again once the
+// savepoint is rolled back.
+func (r *UserRepo) runBestEffort(ctx context.Context, stmts []bulkStatement) ([]error, error) {
+	errs := make([]error, len(stmts))
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		rollback := false
+		for next := 0; next < len(stmts); {
+			end := min(next+bestEffortWindow, len(stmts))
+			failedAt, err := runSavepoints(ctx, tx, stmts[next:end], errs[next:end], rollback)
+			if err != nil {
+				return err
+			}
+			if rollback = failedAt >= 0; rollback {
+				next += failedAt + 1
+			} else {
+				next = end
+			}
+		}
+		if rollback {
+			_, err := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT bulk_item")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// runSavepoints pipelines stmts, each in its own savepoint, and records their
+// outcomes in errs. It stops at the first statement that fails and returns
+// its index, or -1 if none did; the failed savepoint is left for the next
+// call to roll back first, which rollback asks for.
+func runSavepoints(ctx context.Context, tx pgx.Tx, stmts []bulkStatement, errs []error, rollback bool) (int, error) {
+	batch := &pgx.Batch{}
+	if rollback {
+		batch.Queue("ROLLBACK TO SAVEPOINT bulk_item")
+		batch.Queue("RELEASE SAVEPOINT bulk_item")
+	}
+	for _, stmt := range stmts {
+		batch.Queue("SAVEPOINT bulk_item")
+		batch.Queue(stmt.sql, stmt.args...)
+		batch.Queue("RELEASE SAVEPOINT bulk_item")
+	}
+	br := tx.SendBatch(ctx, batch)
+
+	exec := func() error {
+		_, err := br.Exec()
+		return err
+	}
+	if rollback {
+		if err := exec(); err != nil {
+			_ = br.Close()
+			return -1, err
+		}
+		if err := exec(); err != nil {
+			_ = br.Close()
+			return -1, err
+		}
+	}
+	for i, stmt := range stmts {
+		if err := exec(); err != nil {
+			_ = br.Close()
+			return -1, err
+		}
+		tag, err := br.Exec()
+		if err != nil {
+			_ = br.Close()
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) {
+				return -1, err
+			}
+			errs[i] = err
+			return i, nil
+		}
+		if stmt.check != nil {
+			errs[i] = stmt.check(tag)
+		}
+		if err := exec(); err != nil {
+			_ = br.Close()
+			return -1, err
+		}
+	}
+	return -1, br.Close()
+}
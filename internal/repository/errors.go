@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+
+	"app/internal/apperr"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+)
+
+// uniqueViolation is the SQLSTATE of a unique constraint violation.
+const uniqueViolation = "23505"
+
+// dbError wraps a database error with a message. Lost connections and
+// timeouts become apperr Unavailable and unique violations apperr Conflict,
+// so callers can tell them from bugs.
+func dbError(err error, format string, args ...any) error {
+	wrapped := errors.Wrapf(err, format, args...)
+
+	var pgErr *pgconn.PgError
+	var connectErr *pgconn.ConnectError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+		return apperr.Conflict("Record already exists").WithCause(wrapped)
+	case errors.As(err, &connectErr), pgconn.Timeout(err), errors.Is(err, context.DeadlineExceeded):
+		return apperr.Unavailable("Database unavailable").WithCause(wrapped)
+	}
+	return wrapped
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"app/internal/models"
+	"app/internal/tracing"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+const (
+	exportCursor = "users_export"
+	// exportFetch is how many rows are fetched from the export cursor at a
+	// time, which bounds the memory an export holds.
+	exportFetch = 1000
+)
+
+// Export passes every user matching filter, in id order, to fn. Rows are
+// read in batches from a server-side cursor inside one read-only
+// transaction, so the export sees a single snapshot however long it runs.
+// An error from fn stops the export and is returned. With an export timeout
+// the export is cancelled once it runs out, and the server also ends the
+// transaction if it sits idle that long while fn is blocked.
+func (r *UserRepo) Export(ctx context.Context, filter models.UserFilter, fn func(*models.User) error) error {
+	ctx, span := tracing.Start(ctx, "Repository.ExportUsers")
+	defer span.End()
+
+	if r.exportTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.exportTimeout)
+		defer cancel()
+	}
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		slog.Error("Export: Failed to begin transaction", "error", err)
+		return dbError(err, "failed to begin export")
+	}
+	// Nothing is written, so the transaction is always rolled back. The
+	// export's own context may have run out by then.
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	if r.exportTimeout > 0 {
+		timeout := strconv.FormatInt(r.exportTimeout.Milliseconds(), 10)
+		if _, err := tx.Exec(ctx, "SET LOCAL idle_in_transaction_session_timeout = "+timeout); err != nil {
+			slog.Error("Export: Failed to set idle timeout", "error", err)
+			return dbError(err, "failed to begin export")
+		}
+	}
+
+	query, args := userExportSQL(filter)
+	if _, err := tx.Exec(ctx, "DECLARE "+exportCursor+" NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		slog.Error("Export: Failed to declare cursor", "error", err)
+		return dbError(err, "failed to declare export cursor")
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM %s", exportFetch, exportCursor)
+	total := 0
+	for {
+		n, err := exportBatch(ctx, tx, fetch, fn)
+		total += n
+		if err != nil {
+			slog.Error("Export: Export stopped", "exported", total, "error", err)
+			return err
+		}
+		if n < exportFetch {
+			break
+		}
+	}
+
+	slog.Info("Export: Users exported", "count", total)
+	return nil
+}
+
+// exportBatch fetches one batch from the export cursor into fn and returns
+// how many rows it held.
+func exportBatch(ctx context.Context, tx pgx.Tx, fetch string, fn func(*models.User) error) (int, error) {
+	rows, err := tx.Query(ctx, fetch)
+	if err != nil {
+		return 0, dbError(err, "failed to fetch users")
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		user := &models.User{}
+		if err := scanUser(rows, user); err != nil {
+			return n, dbError(err, "failed to scan row")
+		}
+		n++
+		if err := fn(user); err != nil {
+			return n, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, dbError(err, "rows iteration error")
+	}
+	return n, nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"app/internal/models"
+	"app/internal/tracing"
+
+	pgx "github.com/jackc/pgx/v5"
+	pgxpool "github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pkg/errors"
+)
+
+// IdempotencyRepo stores Idempotency-Keys with the response of the request
+// they were first used with.
+type IdempotencyRepo struct {
+	db    *pgxpool.Pool
+	lease time.Duration
+}
+
+// NewIdempotencyRepo creates the repository. A key reserved more than lease
+// ago by a request that neither completed nor released it is free to be
+// reserved again, so a crashed request does not block its retries until the
+// key expires. The lease should be well above the longest a request may run;
+// zero never frees such keys.
+func NewIdempotencyRepo(db *pgxpool.Pool, lease time.Duration) *IdempotencyRepo {
+	return &IdempotencyRepo{db: db, lease: lease}
+}
+
+// Reserve claims key for the request with fingerprint. It returns a nil
+// record when the key was free, or its reservation had outlived the lease,
+// and is now held by the caller, who must Complete or Release it with the
+// returned token; otherwise it returns the record already stored for the
+// key. The token is the time of the reservation: a reservation taken over
+// after the lease has a later one, so its former holder can no longer write.
+func (r *IdempotencyRepo) Reserve(ctx context.Context, key string, fingerprint []byte) (*models.IdempotencyRecord, time.Time, error) {
+	ctx, span := tracing.Start(ctx, "Repository.ReserveIdempotencyKey")
+	defer span.End()
+
+	// The stored record can expire between the two statements; the second
+	// attempt then gets the key.
+	for attempt := 0; attempt < 2; attempt++ {
+		var token time.Time
+		var takenOver bool
+		err := r.db.QueryRow(ctx, `
+			INSERT INTO idempotency_keys (key, fingerprint) VALUES ($1, $2)
+			ON CONFLICT (key) DO UPDATE
+				SET fingerprint = EXCLUDED.fingerprint, created_at = now(), reserved_at = now()
+				WHERE idempotency_keys.status IS NULL
+					AND $3::interval > '0'
+					AND idempotency_keys.reserved_at < now() - $3::interval
+			RETURNING reserved_at, xmax <> 0`,
+			key, fingerprint, r.lease).Scan(&token, &takenOver)
+		if err == nil {
+			if takenOver {
+				slog.Warn("Reserve: Took over an abandoned idempotency key", "lease", r.lease)
+			}
+			return nil, token, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			slog.Error("Reserve: Failed to reserve idempotency key", "error", err)
+			return nil, time.Time{}, dbError(err, "failed to reserve idempotency key")
+		}
+
+		var rec models.IdempotencyRecord
+		var status *int
+		var contentType *string
+		err = r.db.QueryRow(ctx,
+			"SELECT fingerprint, status, content_type, response FROM idempotency_keys WHERE key = $1", key,
+		).Scan(&rec.Fingerprint, &status, &contentType, &rec.Body)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			slog.Error("Reserve: Failed to read idempotency key", "error", err)
+			return nil, time.Time{}, dbError(err, "failed to read idempotency key")
+		}
+		if status != nil {
+			rec.Status = *status
+		}
+		if contentType != nil {
+			rec.ContentType = *contentType
+		}
+		return &rec, time.Time{}, nil
+	}
+	return nil, time.Time{}, errors.New("idempotency key expired while being reserved")
+}
+
+// Complete stores the response of the request holding the reservation of
+// key identified by token. It fails if the reservation has been taken over.
+func (r *IdempotencyRepo) Complete(ctx context.Context, key string, token time.Time, status int, contentType string, body []byte) error {
+	ctx, span := tracing.Start(ctx, "Repository.CompleteIdempotencyKey")
+	defer span.End()
+
+	tag, err := r.db.Exec(ctx,
+		"UPDATE idempotency_keys SET status = $3, content_type = $4, response = $5 WHERE key = $1 AND reserved_at = $2 AND status IS NULL",
+		key, token, status, contentType, body)
+	if err != nil {
+		slog.Error("Complete: Failed to store idempotent response", "error", err)
+		return dbError(err, "failed to store idempotent response")
+	}
+	if tag.RowsAffected() == 0 {
+		slog.Warn("Complete: Idempotency key is no longer reserved by this request")
+		return errors.New("idempotency key reservation was lost")
+	}
+	return nil
+}
+
+// Release frees key after its request failed, so it can be retried. Only
+// the reservation identified by token is freed.
+func (r *IdempotencyRepo) Release(ctx context.Context, key string, token time.Time) error {
+	ctx, span := tracing.Start(ctx, "Repository.ReleaseIdempotencyKey")
+	defer span.End()
+
+	_, err := r.db.Exec(ctx,
+		"DELETE FROM idempotency_keys WHERE key = $1 AND reserved_at = $2 AND status IS NULL", key, token)
+	if err != nil {
+		slog.Error("Release: Failed to release idempotency key", "error", err)
+		return dbError(err, "failed to release idempotency key")
+	}
+	return nil
+}
+
+// DeleteExpired deletes the keys created more than ttl ago and returns how
+// many there were.
+func (r *IdempotencyRepo) DeleteExpired(ctx context.Context, ttl time.Duration) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.DeleteExpiredIdempotencyKeys")
+	defer span.End()
+
+	tag, err := r.db.Exec(ctx,
+		"DELETE FROM idempotency_keys WHERE created_at < now() - $1::interval", ttl)
+	if err != nil {
+		slog.Error("DeleteExpired: Failed to delete expired idempotency keys", "error", err)
+		return 0, dbError(err, "failed to delete expired idempotency keys")
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"app/internal/models"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+)
+
+// userColumns are the columns scanUser reads, in order.
+const userColumns = "id, name, age, version, deleted_at"
+
+// scanUser reads a row selected with userColumns.
+func scanUser(row pgx.Row, user *models.User) error {
+	return row.Scan(&user.ID, &user.Name, &user.Age, &user.Version, &user.DeletedAt)
+}
+
+// userSortColumns maps sortable fields to their columns. Only these names
+// ever reach the SQL text; all values are bound as parameters.
+var userSortColumns = map[string]string{
+	"id":   "id",
+	"name": "name",
+	"age":  "age",
+}
+
+// userListSQL builds the listing query for q. Rows are always ordered by id
+// last, so every sort is total and keyset paging never skips or repeats a
+// row.
+func userListSQL(q models.UserQuery) (string, []any, error) {
+	sort := q.Sort
+	if !sortsByID(sort) {
+		sort = append(sort[:len(sort):len(sort)], models.SortField{Field: "id"})
+	}
+
+	columns := make([]string, len(sort))
+	order := make([]string, len(sort))
+	for i, f := range sort {
+		column, ok := userSortColumns[f.Field]
+		if !ok {
+			return "", nil, errors.Errorf("unsupported sort field %q", f.Field)
+		}
+		columns[i] = column
+		order[i] = column + " ASC"
+		if f.Desc {
+			order[i] = column + " DESC"
+		}
+	}
+
+	var sb strings.Builder
+	where, args := userFilterConditions(q.Filter, nil)
+	if q.After != nil {
+		var keyset string
+		keyset, args = keysetPredicate(sort, columns, q.After, args)
+		where = append(where, keyset)
+	}
+	sb.WriteString("SELECT " + userColumns + " FROM users")
+	if len(where) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(where, " AND "))
+	}
+	sb.WriteString(" ORDER BY ")
+	sb.WriteString(strings.Join(order, ", "))
+
+	args = append(args, q.Limit, q.Offset)
+	fmt.Fprintf(&sb, " LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	return sb.String(), args, nil
+}
+
+// userCountSQL builds the exact count query for f.
+func userCountSQL(f models.UserFilter) (string, []any) {
+	where, args := userFilterConditions(f, nil)
+	query := "SELECT count(*) FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	return query, args
+}
+
+// userExportSQL builds the query behind the export cursor: every user
+// matching f, in id order.
+func userExportSQL(f models.UserFilter) (string, []any) {
+	where, args := userFilterConditions(f, nil)
+	query := "SELECT " + userColumns + " FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	return query + " ORDER BY id", args
+}
+
+// versionArg is the version a conditional write compares in SQL, where zero
+// matches any. models.AnyVersion matches any as well: the write itself only
+// finds an existing user.
+func versionArg(version int64) int64 {
+	if version == models.AnyVersion {
+		return 0
+	}
+	return version
+}
+
+// userPatchSQL builds a partial update of the fields set in p, conditional
+// on version unless it is zero or models.AnyVersion. p must not be empty.
+func userPatchSQL(id string, p models.UserPatch, version int64) (string, []any) {
+	var (
+		sets []string
+		args []any
+	)
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s=$%d", column, len(args)))
+	}
+	if p.Name != nil {
+		set("name", *p.Name)
+	}
+	if p.Age != nil {
+		set("age", *p.Age)
+	}
+
+	args = append(args, id, versionArg(version))
+	query := fmt.Sprintf("UPDATE users SET %s WHERE id=$%d AND deleted_at IS NULL AND ($%d::bigint = 0 OR version = $%d) RETURNING %s",
+		strings.Join(sets, ", "), len(args)-1, len(args), len(args), userColumns)
+	return query, args
+}
+
+// userFilterConditions returns the WHERE conditions for f, binding its
+// values after args. Soft-deleted users are left out unless f includes them.
+func userFilterConditions(f models.UserFilter, args []any) ([]string, []any) {
+	var conds []string
+	if !f.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	bind := func(cond string, value any) {
+		args = append(args, value)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.NamePrefix != "" {
+		bind(`name ILIKE $%d ESCAPE '\'`, escapeLike(f.NamePrefix)+"%")
+	}
+	if f.NameContains != "" {
+		bind(`name ILIKE $%d ESCAPE '\'`, "%"+escapeLike(f.NameContains)+"%")
+	}
+	if f.AgeMin != nil {
+		bind("age >= $%d", *f.AgeMin)
+	}
+	if f.AgeMax != nil {
+		bind("age <= $%d", *f.AgeMax)
+	}
+	return conds, args
+}
+
+// likeEscaper makes user input match literally inside a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+func sortsByID(sort []models.SortField) bool {
+	for _, f := range sort {
+		if f.Field == "id" {
+			return true
+		}
+	}
+	return false
+}
+
+// keysetPredicate matches the rows that sort after the cursor position:
+// (a > $1) OR (a = $1 AND b < $2) OR ..., with the comparison flipped for
+// descending fields.
+func keysetPredicate(sort []models.SortField, columns []string, after *models.UserCursor, args []any) (string, []any) {
+	params := make([]string, len(sort))
+	for i, f := range sort {
+		args = append(args, cursorValue(after, f.Field))
+		params[i] = fmt.Sprintf("$%d", len(args))
+	}
+
+	terms := make([]string, len(sort))
+	for i, f := range sort {
+		conds := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			conds = append(conds, columns[j]+" = "+params[j])
+		}
+		op := " > "
+		if f.Desc {
+			op = " < "
+		}
+		conds = append(conds, columns[i]+op+params[i])
+		terms[i] = "(" + strings.Join(conds, " AND ") + ")"
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", args
+}
+
+func cursorValue(c *models.UserCursor, field string) any {
+	switch field {
+	case "name":
+		return c.Name
+	case "age":
+		return c.Age
+	default:
+		return c.ID
+	}
+}
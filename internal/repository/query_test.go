@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"testing"
+
+	"app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserListSQL_Offset(t *testing.T) {
+	query, args, err := userListSQL(models.UserQuery{Limit: 10, Offset: 20})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT id, name, age, version, deleted_at FROM users WHERE deleted_at IS NULL ORDER BY id ASC LIMIT $1 OFFSET $2", query)
+	assert.Equal(t, []any{10, 20}, args)
+}
+
+func TestUserListSQL_KeysetByID(t *testing.T) {
+	query, args, err := userListSQL(models.UserQuery{
+		Limit: 10,
+		After: &models.UserCursor{Sort: "id", ID: "abc"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT id, name, age, version, deleted_at FROM users WHERE deleted_at IS NULL AND ((id > $1)) ORDER BY id ASC LIMIT $2 OFFSET $3", query)
+	assert.Equal(t, []any{"abc", 10, 0}, args)
+}
+
+func TestUserListSQL_KeysetBySortKey(t *testing.T) {
+	sort := []models.SortField{{Field: "age", Desc: true}}
+	query, args, err := userListSQL(models.UserQuery{
+		Limit: 5,
+		Sort:  sort,
+		After: &models.UserCursor{Sort: "-age", ID: "abc", Age: 30},
+	})
+	require.NoError(t, err)
+	assert.Equal(t,
+		"SELECT id, name, age, version, deleted_at FROM users WHERE deleted_at IS NULL AND ((age < $1) OR (age = $1 AND id > $2)) "+
+			"ORDER BY age DESC, id ASC LIMIT $3 OFFSET $4", query)
+	assert.Equal(t, []any{30, "abc", 5, 0}, args)
+	assert.Len(t, sort, 1, "the caller's sort must not be extended in place")
+}
+
+func TestUserListSQL_RejectsUnknownField(t *testing.T) {
+	_, _, err := userListSQL(models.UserQuery{Limit: 1, Sort: []models.SortField{{Field: "password"}}})
+	assert.Error(t, err)
+}
+
+func TestUserListSQL_Filters(t *testing.T) {
+	minAge, maxAge := 18, 65
+	query, args, err := userListSQL(models.UserQuery{
+		Limit: 10,
+		Filter: models.UserFilter{
+			NamePrefix:   "al_",
+			NameContains: "100%",
+			AgeMin:       &minAge,
+			AgeMax:       &maxAge,
+		},
+		Sort:  []models.SortField{{Field: "name"}, {Field: "age", Desc: true}},
+		After: &models.UserCursor{Sort: "name,-age", ID: "abc", Name: "Alice", Age: 30},
+	})
+	require.NoError(t, err)
+	assert.Equal(t,
+		`SELECT id, name, age, version, deleted_at FROM users WHERE deleted_at IS NULL AND name ILIKE $1 ESCAPE '\' AND name ILIKE $2 ESCAPE '\' `+
+			`AND age >= $3 AND age <= $4 `+
+			`AND ((name > $5) OR (name = $5 AND age < $6) OR (name = $5 AND age = $6 AND id > $7)) `+
+			`ORDER BY name ASC, age DESC, id ASC LIMIT $8 OFFSET $9`, query)
+	assert.Equal(t, []any{`al\_%`, `%100\%%`, 18, 65, "Alice", 30, "abc", 10, 0}, args)
+}
+
+func TestUserCountSQL(t *testing.T) {
+	query, args := userCountSQL(models.UserFilter{})
+	assert.Equal(t, "SELECT count(*) FROM users WHERE deleted_at IS NULL", query)
+	assert.Empty(t, args)
+
+	query, args = userCountSQL(models.UserFilter{NameContains: "al"})
+	assert.Equal(t, `SELECT count(*) FROM users WHERE deleted_at IS NULL AND name ILIKE $1 ESCAPE '\'`, query)
+	assert.Equal(t, []any{"%al%"}, args)
+
+	query, args = userCountSQL(models.UserFilter{IncludeDeleted: true})
+	assert.Equal(t, "SELECT count(*) FROM users", query)
+	assert.Empty(t, args)
+}
+
+func TestUserSearchArgs(t *testing.T) {
+	assert.Equal(t, []any{"ann", "ann%", 10}, userSearchArgs("ann", 10))
+	assert.Equal(t, []any{`50%_off\`, `50\%\_off\\%`, 5}, userSearchArgs(`50%_off\`, 5),
+		"LIKE wildcards in the term match literally")
+}
+
+func TestUserPatchSQL(t *testing.T) {
+	age := 31
+	query, args := userPatchSQL("u1", models.UserPatch{Age: &age}, 4)
+
+	assert.Equal(t, "UPDATE users SET age=$1 WHERE id=$2 AND deleted_at IS NULL AND ($3::bigint = 0 OR version = $3) RETURNING id, name, age, version, deleted_at", query)
+	assert.Equal(t, []any{31, "u1", int64(4)}, args)
+
+	name := "Ann"
+	query, args = userPatchSQL("u1", models.UserPatch{Name: &name, Age: &age}, 0)
+	assert.Equal(t, "UPDATE users SET name=$1, age=$2 WHERE id=$3 AND deleted_at IS NULL AND ($4::bigint = 0 OR version = $4) RETURNING id, name, age, version, deleted_at", query)
+	assert.Equal(t, []any{"Ann", 31, "u1", int64(0)}, args)
+
+	_, args = userPatchSQL("u1", models.UserPatch{Age: &age}, models.AnyVersion)
+	assert.Equal(t, []any{31, "u1", int64(0)}, args, "If-Match: * compares no version")
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"log/slog"
+	"time"
 
 	"app/internal/apperr"
 	"app/internal/models"
@@ -14,52 +15,243 @@ import (
 	"github.com/pkg/errors"
 )
 
+// UserChangesChannel is the NOTIFY channel the users table triggers publish
+// UserChanges on, one or more per statement that inserts, updates or deletes
+// rows.
+const UserChangesChannel = "users_changed"
+
+// UserChanges is the payload of a UserChangesChannel notification.
+type UserChanges struct {
+	// Origin is the application_name of the session that made the changes.
+	Origin string `json:"origin"`
+	// IDs are the users changed.
+	IDs []string `json:"ids"`
+}
+
 type UserRepo struct {
-	db *pgxpool.Pool
+	db            *pgxpool.Pool
+	estimateAbove int64
+	exportTimeout time.Duration
+}
+
+type RepoOption func(*UserRepo)
+
+// WithCountEstimateAbove makes unfiltered counts use the planner's row
+// estimate once it exceeds n, instead of scanning the table. Zero always
+// counts exactly.
+func WithCountEstimateAbove(n int64) RepoOption {
+	return func(r *UserRepo) {
+		r.estimateAbove = n
+	}
+}
+
+// WithExportTimeout ends an export that is still running after d, so a client
+// that reads slowly or not at all cannot hold a connection and an old
+// snapshot indefinitely. Zero leaves exports unbounded.
+func WithExportTimeout(d time.Duration) RepoOption {
+	return func(r *UserRepo) {
+		r.exportTimeout = d
+	}
 }
 
 type UserProvider interface {
 	Create(ctx context.Context, user *models.User) (string, error)
 	Update(ctx context.Context, user *models.User) error
+	Upsert(ctx context.Context, user *models.User) (bool, error)
 	Get(ctx context.Context, id string) (*models.User, error)
 	Delete(ctx context.Context, id string) error
-	GetAll(ctx context.Context, limit, offset int) ([]*models.User, error)
+	DeleteIfVersion(ctx context.Context, id string, version int64) error
+	Restore(ctx context.Context, id string) (*models.User, error)
+	Patch(ctx context.Context, id string, patch models.UserPatch, version int64) (*models.User, error)
+	GetAll(ctx context.Context, q models.UserQuery) ([]*models.User, error)
+	Count(ctx context.Context, filter models.UserFilter) (models.UserCount, error)
+	Search(ctx context.Context, term string, limit int) ([]*models.UserMatch, error)
+	CreateMany(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error)
+	UpdateMany(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error)
+	DeleteMany(ctx context.Context, ids []string, mode models.BulkMode) ([]models.BulkResult, error)
+	Export(ctx context.Context, filter models.UserFilter, fn func(*models.User) error) error
 }
 
-func NewUserRepo(db *pgxpool.Pool) *UserRepo {
-	return &UserRepo{db: db}
+func NewUserRepo(db *pgxpool.Pool, opts ...RepoOption) *UserRepo {
+	r := &UserRepo{db: db}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
-func (r *UserRepo) GetAll(ctx context.Context, limit, offset int) ([]*models.User, error) {
+func (r *UserRepo) GetAll(ctx context.Context, q models.UserQuery) ([]*models.User, error) {
 	ctx, span := tracing.Start(ctx, "Repository.GetAllUsers")
 	defer span.End()
 
+	query, args, err := userListSQL(q)
+	if err != nil {
+		return nil, dbError(err, "failed to build users query")
+	}
+
 	var users []*models.User
-	query := "SELECT id, name, age FROM users ORDER BY id LIMIT $1 OFFSET $2"
-	rows, err := r.db.Query(ctx, query, limit, offset)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		slog.Error("GetAll: Failed to query users", "limit", limit, "offset", offset, "error", err)
-		return nil, errors.Wrap(err, "failed to fetch users")
+		slog.Error("GetAll: Failed to query users", "limit", q.Limit, "offset", q.Offset, "error", err)
+		return nil, dbError(err, "failed to fetch users")
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		user := &models.User{}
-		if err := rows.Scan(&user.ID, &user.Name, &user.Age); err != nil {
+		if err := scanUser(rows, user); err != nil {
 			slog.Error("GetAll: Failed to scan row", "error", err)
-			return nil, errors.Wrap(err, "failed to scan row")
+			return nil, dbError(err, "failed to scan row")
 		}
 		users = append(users, user)
 	}
 	if err := rows.Err(); err != nil {
 		slog.Error("GetAll: Rows iteration error", "error", err)
-		return nil, errors.Wrap(err, "rows iteration error")
+		return nil, dbError(err, "rows iteration error")
 	}
 
 	slog.Info("GetAll: Users retrieved", "count", len(users))
 	return users, nil
 }
 
+// Count returns how many users match filter. Unfiltered counts of tables
+// larger than the estimate threshold come from pg_class instead of a scan,
+// less the soft-deleted users that are not purged yet; those are counted
+// exactly from the deleted_at index.
+func (r *UserRepo) Count(ctx context.Context, filter models.UserFilter) (models.UserCount, error) {
+	ctx, span := tracing.Start(ctx, "Repository.CountUsers")
+	defer span.End()
+
+	if r.estimateAbove > 0 && filter == (models.UserFilter{}) {
+		var estimate int64
+		err := r.db.QueryRow(ctx,
+			`SELECT reltuples::bigint - (SELECT count(*) FROM users WHERE deleted_at IS NOT NULL)
+			FROM pg_class WHERE oid = 'users'::regclass`).Scan(&estimate)
+		if err != nil {
+			slog.Warn("Count: Failed to read row estimate, counting exactly", "error", err)
+		} else if estimate > r.estimateAbove {
+			return models.UserCount{Total: estimate, Estimated: true}, nil
+		}
+	}
+
+	query, args := userCountSQL(filter)
+	var total int64
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+		slog.Error("Count: Failed to count users", "error", err)
+		return models.UserCount{}, dbError(err, "failed to count users")
+	}
+	return models.UserCount{Total: total}, nil
+}
+
+// userSearchSQL ranks names by trigram similarity to the whole term or to
+// any word in them, after folding case and accents. Prefix matches rank
+// first, so short terms that trigrams cannot match well still find names.
+const userSearchSQL = `
+WITH q AS (SELECT users_search_text($1) AS term, users_search_text($2) AS prefix)
+SELECT id, name, age, version,
+       greatest(similarity(search_name, q.term), word_similarity(q.term, search_name)) AS score
+FROM users, q
+WHERE deleted_at IS NULL
+  AND (search_name % q.term OR q.term <% search_name OR search_name LIKE q.prefix ESCAPE '\')
+ORDER BY search_name LIKE q.prefix ESCAPE '\' DESC, score DESC, id
+LIMIT $3`
+
+// userSearchArgs binds term to userSearchSQL, matching it literally as a
+// name prefix.
+func userSearchArgs(term string, limit int) []any {
+	return []any{term, escapeLike(term) + "%", limit}
+}
+
+// Search finds users by name, tolerating typos, accents and case, and
+// returns the best matches first.
+func (r *UserRepo) Search(ctx context.Context, term string, limit int) ([]*models.UserMatch, error) {
+	ctx, span := tracing.Start(ctx, "Repository.SearchUsers")
+	defer span.End()
+
+	var matches []*models.UserMatch
+	rows, err := r.db.Query(ctx, userSearchSQL, userSearchArgs(term, limit)...)
+	if err != nil {
+		slog.Error("Search: Failed to query users", "term", term, "error", err)
+		return nil, dbError(err, "failed to search users")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &models.UserMatch{User: &models.User{}}
+		if err := rows.Scan(&m.User.ID, &m.User.Name, &m.User.Age, &m.User.Version, &m.Score); err != nil {
+			slog.Error("Search: Failed to scan row", "error", err)
+			return nil, dbError(err, "failed to scan row")
+		}
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("Search: Rows iteration error", "error", err)
+		return nil, dbError(err, "rows iteration error")
+	}
+	return matches, nil
+}
+
+// RecentlyUpdated returns up to limit users, most recently created or
+// updated first.
+func (r *UserRepo) RecentlyUpdated(ctx context.Context, limit int) ([]*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Repository.RecentlyUpdatedUsers")
+	defer span.End()
+
+	var users []*models.User
+	rows, err := r.db.Query(ctx,
+		"SELECT "+userColumns+" FROM users WHERE deleted_at IS NULL ORDER BY updated_at DESC LIMIT $1", limit)
+	if err != nil {
+		slog.Error("RecentlyUpdated: Failed to query users", "limit", limit, "error", err)
+		return nil, dbError(err, "failed to fetch recently updated users")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := &models.User{}
+		if err := scanUser(rows, user); err != nil {
+			slog.Error("RecentlyUpdated: Failed to scan row", "error", err)
+			return nil, dbError(err, "failed to scan row")
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("RecentlyUpdated: Rows iteration error", "error", err)
+		return nil, dbError(err, "rows iteration error")
+	}
+	return users, nil
+}
+
+// Versions returns the current version of each of ids that exists and is not
+// deleted. Ids without a user are left out.
+func (r *UserRepo) Versions(ctx context.Context, ids []string) (map[string]int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.UserVersions")
+	defer span.End()
+
+	versions := make(map[string]int64, len(ids))
+	rows, err := r.db.Query(ctx,
+		"SELECT id, version FROM users WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL", ids)
+	if err != nil {
+		slog.Error("Versions: Failed to query users", "ids", len(ids), "error", err)
+		return nil, dbError(err, "failed to fetch user versions")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var version int64
+		if err := rows.Scan(&id, &version); err != nil {
+			slog.Error("Versions: Failed to scan row", "error", err)
+			return nil, dbError(err, "failed to scan row")
+		}
+		versions[id] = version
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("Versions: Rows iteration error", "error", err)
+		return nil, dbError(err, "rows iteration error")
+	}
+	return versions, nil
+}
+
 func (r *UserRepo) Create(ctx context.Context, user *models.User) (string, error) {
 	ctx, span := tracing.Start(ctx, "Repository.CreateUser")
 	defer span.End()
@@ -67,13 +259,13 @@ func (r *UserRepo) Create(ctx context.Context, user *models.User) (string, error
 	id := uuid.New().String()
 	user.ID = id
 
-	_, err := r.db.Exec(ctx,
-		"INSERT INTO users (id, name, age) VALUES ($1, $2, $3)",
-		user.ID, user.Name, user.Age)
+	err := r.db.QueryRow(ctx,
+		"INSERT INTO users (id, name, age) VALUES ($1, $2, $3) RETURNING version",
+		user.ID, user.Name, user.Age).Scan(&user.Version)
 
 	if err != nil {
 		slog.Error("Create: Failed to insert user", "user", user, "error", err)
-		return "", errors.Wrap(err, "failed to create user")
+		return "", dbError(err, "failed to create user")
 	}
 
 	slog.Info("Create: User created", "user", user)
@@ -85,45 +277,82 @@ func (r *UserRepo) Get(ctx context.Context, id string) (*models.User, error) {
 	defer span.End()
 
 	var user models.User
-	err := r.db.QueryRow(ctx,
-		"SELECT id, name, age FROM users WHERE id=$1", id).
-		Scan(&user.ID, &user.Name, &user.Age)
+	err := scanUser(r.db.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id=$1 AND deleted_at IS NULL", id), &user)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			slog.Info("Get: User not found", "id", id, "error", err)
 			return nil, errors.Wrapf(apperr.ErrNotFound, "Get user %s:", id)
 		}
 		slog.Error("Get: Database query failed", "id", id, "error", err)
-		return nil, errors.Wrapf(err, "failed to query user %s:", id)
+		return nil, dbError(err, "failed to query user %s:", id)
 	}
 	return &user, nil
 }
 
+// Update writes the user's name and age. A non-zero user.Version makes the
+// write conditional on the stored version; either way user.Version holds
+// the new version afterwards.
 func (r *UserRepo) Update(ctx context.Context, user *models.User) error {
 	ctx, span := tracing.Start(ctx, "Repository.UpdateUser")
 	defer span.End()
 
-	cmd, err := r.db.Exec(ctx,
-		"UPDATE users SET name=$1, age=$2 WHERE id=$3", user.Name, user.Age, user.ID)
+	err := r.db.QueryRow(ctx,
+		"UPDATE users SET name=$1, age=$2 WHERE id=$3 AND deleted_at IS NULL AND ($4::bigint = 0 OR version = $4) RETURNING version",
+		user.Name, user.Age, user.ID, versionArg(user.Version)).Scan(&user.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r.missingOrConflict(ctx, "Update", user.ID, user.Version)
+	}
 	if err != nil {
 		slog.Error("Update: DB error", "error", err)
-		return errors.Wrap(err, "update query failed")
-	}
-	if cmd.RowsAffected() == 0 {
-		slog.Warn("Update: User not found", "userID", user.ID)
-		return apperr.ErrNotFound
+		return dbError(err, "update query failed")
 	}
 	return nil
 }
 
+// userUpsertSQL inserts the user or replaces the one with its id. xmax is
+// zero only for a row this statement inserted. A soft-deleted user is left
+// alone, so no row comes back.
+const userUpsertSQL = `
+INSERT INTO users (id, name, age) VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, age = EXCLUDED.age
+WHERE users.deleted_at IS NULL
+RETURNING version, xmax = 0`
+
+// Upsert creates the user with its own id, or replaces the user with that
+// id, and reports whether it was created. A non-zero user.Version makes it
+// a conditional Update, as there is nothing to compare a new user with.
+func (r *UserRepo) Upsert(ctx context.Context, user *models.User) (bool, error) {
+	ctx, span := tracing.Start(ctx, "Repository.UpsertUser")
+	defer span.End()
+
+	if user.Version != 0 {
+		return false, r.Update(ctx, user)
+	}
+
+	var created bool
+	err := r.db.QueryRow(ctx, userUpsertSQL, user.ID, user.Name, user.Age).Scan(&user.Version, &created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		slog.Info("Upsert: User is deleted", "userID", user.ID)
+		return false, apperr.Conflict("User has been deleted; restore it first")
+	}
+	if err != nil {
+		slog.Error("Upsert: DB error", "error", err)
+		return false, dbError(err, "upsert query failed")
+	}
+	slog.Info("Upsert: User written", "user", user, "created", created)
+	return created, nil
+}
+
+// Delete soft-deletes the user: it is kept, marked deleted, until it is
+// restored or purged.
 func (r *UserRepo) Delete(ctx context.Context, id string) error {
 	ctx, span := tracing.Start(ctx, "Repository.DeleteUser")
 	defer span.End()
 
-	cmd, err := r.db.Exec(ctx, "DELETE FROM users WHERE id=$1", id)
+	cmd, err := r.db.Exec(ctx, "UPDATE users SET deleted_at = now() WHERE id=$1 AND deleted_at IS NULL", id)
 	if err != nil {
 		slog.Error("Delete: DB error", "error", err)
-		return errors.Wrap(err, "delete query failed")
+		return dbError(err, "delete query failed")
 	}
 	if cmd.RowsAffected() == 0 {
 		slog.Warn("Delete: User not found", "userID", id)
@@ -131,3 +360,124 @@ func (r *UserRepo) Delete(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+// Patch updates only the fields set in patch, conditional on version unless
+// it is zero, and returns the updated user. An empty patch just reads the
+// user, still checking the version.
+func (r *UserRepo) Patch(ctx context.Context, id string, patch models.UserPatch, version int64) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Repository.PatchUser")
+	defer span.End()
+
+	if patch.IsEmpty() {
+		user, err := r.Get(ctx, id)
+		if err == nil && !user.AtVersion(version) {
+			slog.Info("Patch: Version mismatch", "userID", id, "version", version)
+			return nil, errors.Wrapf(apperr.ErrPreconditionFailed, "user %s is not at version %d", id, version)
+		}
+		return user, err
+	}
+
+	query, args := userPatchSQL(id, patch, version)
+	var user models.User
+	err := scanUser(r.db.QueryRow(ctx, query, args...), &user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, r.missingOrConflict(ctx, "Patch", id, version)
+	}
+	if err != nil {
+		slog.Error("Patch: DB error", "error", err)
+		return nil, dbError(err, "patch query failed")
+	}
+	return &user, nil
+}
+
+// DeleteIfVersion soft-deletes the user only while it is at version, or
+// while it exists for models.AnyVersion.
+func (r *UserRepo) DeleteIfVersion(ctx context.Context, id string, version int64) error {
+	ctx, span := tracing.Start(ctx, "Repository.DeleteUser")
+	defer span.End()
+
+	cmd, err := r.db.Exec(ctx,
+		"UPDATE users SET deleted_at = now() WHERE id=$1 AND deleted_at IS NULL AND ($2::bigint = 0 OR version = $2)", id, versionArg(version))
+	if err != nil {
+		slog.Error("DeleteIfVersion: DB error", "error", err)
+		return dbError(err, "delete query failed")
+	}
+	if cmd.RowsAffected() == 0 {
+		return r.missingOrConflict(ctx, "DeleteIfVersion", id, version)
+	}
+	return nil
+}
+
+// Restore undoes the soft delete of a user and returns it.
+func (r *UserRepo) Restore(ctx context.Context, id string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Repository.RestoreUser")
+	defer span.End()
+
+	var user models.User
+	err := scanUser(r.db.QueryRow(ctx,
+		"UPDATE users SET deleted_at = NULL WHERE id=$1 AND deleted_at IS NOT NULL RETURNING "+userColumns, id), &user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		var exists bool
+		if err := r.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)", id).Scan(&exists); err != nil {
+			slog.Error("Restore: DB error", "error", err)
+			return nil, dbError(err, "restore check failed")
+		}
+		if exists {
+			slog.Info("Restore: User is not deleted", "userID", id)
+			return nil, apperr.Conflict("User is not deleted")
+		}
+		slog.Warn("Restore: User not found", "userID", id)
+		return nil, apperr.ErrNotFound
+	}
+	if err != nil {
+		slog.Error("Restore: DB error", "error", err)
+		return nil, dbError(err, "restore query failed")
+	}
+	return &user, nil
+}
+
+// purgeBatch is the number of users PurgeDeleted removes per statement, to
+// keep each transaction short.
+const purgeBatch = 1000
+
+// PurgeDeleted permanently removes the users soft-deleted more than age ago
+// and returns how many there were.
+func (r *UserRepo) PurgeDeleted(ctx context.Context, age time.Duration) (int64, error) {
+	ctx, span := tracing.Start(ctx, "Repository.PurgeDeletedUsers")
+	defer span.End()
+
+	var purged int64
+	for {
+		cmd, err := r.db.Exec(ctx, `
+DELETE FROM users WHERE id IN (
+    SELECT id FROM users WHERE deleted_at < now() - $1::interval LIMIT $2
+)`, age, purgeBatch)
+		if err != nil {
+			slog.Error("PurgeDeleted: DB error", "purged", purged, "error", err)
+			return purged, dbError(err, "purge query failed")
+		}
+		purged += cmd.RowsAffected()
+		if cmd.RowsAffected() < purgeBatch {
+			return purged, nil
+		}
+	}
+}
+
+// missingOrConflict explains why a write conditional on version matched no
+// row: either the user does not exist or it is at another version.
+func (r *UserRepo) missingOrConflict(ctx context.Context, op, id string, version int64) error {
+	if versionArg(version) != 0 {
+		var exists bool
+		err := r.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id=$1 AND deleted_at IS NULL)", id).Scan(&exists)
+		if err != nil {
+			slog.Error(op+": DB error", "error", err)
+			return dbError(err, "version check failed")
+		}
+		if exists {
+			slog.Info(op+": Version mismatch", "userID", id, "version", version)
+			return errors.Wrapf(apperr.ErrPreconditionFailed, "user %s is not at version %d", id, version)
+		}
+	}
+	slog.Warn(op+": User not found", "userID", id)
+	return apperr.ErrNotFound
+}
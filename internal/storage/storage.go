@@ -5,15 +5,26 @@ import (
 	"log/slog"
 	"time"
 
+	pgx "github.com/jackc/pgx/v5"
 	pgxpool "github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
 )
 
-func GetConnect(ctx context.Context, connStr string) (*pgxpool.Pool, error) {
+// GetConnect opens the connection pool. Its sessions report appName as their
+// application_name, which tells this process's writes apart in change
+// notifications.
+func GetConnect(ctx context.Context, connStr, appName string) (*pgxpool.Pool, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	pool, err := pgxpool.New(ctx, connStr)
+	cfg, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		slog.Error("Invalid database connection string", "error", err)
+		return nil, errors.Wrap(err, "parse database connection string")
+	}
+	cfg.ConnConfig.RuntimeParams["application_name"] = appName
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
 		slog.Error("Unable to connect to database", "error", err)
 		return nil, errors.Wrap(err, "unable to connect to database")
@@ -27,3 +38,16 @@ func GetConnect(ctx context.Context, connStr string) (*pgxpool.Pool, error) {
 	slog.Info("Connected to database")
 	return pool, nil
 }
+
+// GetConn opens a single dedicated connection, for sessions such as LISTEN
+// that must not be shared through the pool.
+func GetConn(ctx context.Context, connStr string) (*pgx.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open dedicated connection")
+	}
+	return conn, nil
+}
@@ -20,6 +20,12 @@ func Start(ctx context.Context, name string) (context.Context, trace.Span) {
 	return tracer.Start(ctx, name)
 }
 
+// StartLinked starts a new root span linked to links, for work that is
+// shared by several callers instead of owned by one.
+func StartLinked(ctx context.Context, name string, links ...trace.Link) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithNewRoot(), trace.WithLinks(links...))
+}
+
 func Init(ctx context.Context, cfg config.TracingConfig) func(context.Context) error {
 	exp, err := otlptracehttp.New(ctx,
 		otlptracehttp.WithEndpoint(cfg.JaegerEndpoint),
@@ -15,19 +15,40 @@ type UserUsecase struct {
 type UserProvider interface {
 	CreateUser(ctx context.Context, user *models.User) (string, error)
 	UpdateUser(ctx context.Context, user *models.User) error
+	UpsertUser(ctx context.Context, user *models.User) (bool, error)
 	GetUser(ctx context.Context, id string) (*models.User, error)
-	DeleteUser(ctx context.Context, id string) error
-	GetAllUsers(ctx context.Context, limit, offset int) ([]*models.User, error)
+	PatchUser(ctx context.Context, id string, patch models.UserPatch, version int64) (*models.User, error)
+	DeleteUser(ctx context.Context, id string, version int64) error
+	RestoreUser(ctx context.Context, id string) (*models.User, error)
+	GetAllUsers(ctx context.Context, q models.UserQuery) ([]*models.User, error)
+	CountUsers(ctx context.Context, filter models.UserFilter) (models.UserCount, error)
+	SearchUsers(ctx context.Context, term string, limit int) ([]*models.UserMatch, error)
+	CreateUsers(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error)
+	UpdateUsers(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error)
+	DeleteUsers(ctx context.Context, ids []string, mode models.BulkMode) ([]models.BulkResult, error)
+	ExportUsers(ctx context.Context, filter models.UserFilter, fn func(*models.User) error) error
 }
 
 func NewUserUsecase(repo repository.UserProvider) *UserUsecase {
 	return &UserUsecase{userRepo: repo}
 }
 
-func (uc *UserUsecase) GetAllUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
+func (uc *UserUsecase) GetAllUsers(ctx context.Context, q models.UserQuery) ([]*models.User, error) {
 	ctx, span := tracing.Start(ctx, "Usecase.GetAllUsers")
 	defer span.End()
-	return uc.userRepo.GetAll(ctx, limit, offset)
+	return uc.userRepo.GetAll(ctx, q)
+}
+
+func (uc *UserUsecase) CountUsers(ctx context.Context, filter models.UserFilter) (models.UserCount, error) {
+	ctx, span := tracing.Start(ctx, "Usecase.CountUsers")
+	defer span.End()
+	return uc.userRepo.Count(ctx, filter)
+}
+
+func (uc *UserUsecase) SearchUsers(ctx context.Context, term string, limit int) ([]*models.UserMatch, error) {
+	ctx, span := tracing.Start(ctx, "Usecase.SearchUsers")
+	defer span.End()
+	return uc.userRepo.Search(ctx, term, limit)
 }
 
 func (uc *UserUsecase) CreateUser(ctx context.Context, user *models.User) (string, error) {
@@ -42,14 +63,64 @@ func (uc *UserUsecase) UpdateUser(ctx context.Context, user *models.User) error
 	return uc.userRepo.Update(ctx, user)
 }
 
+// UpsertUser creates the user with its own id or replaces the existing one,
+// and reports whether it was created.
+func (uc *UserUsecase) UpsertUser(ctx context.Context, user *models.User) (bool, error) {
+	ctx, span := tracing.Start(ctx, "Usecase.UpsertUser")
+	defer span.End()
+	return uc.userRepo.Upsert(ctx, user)
+}
+
+func (uc *UserUsecase) PatchUser(ctx context.Context, id string, patch models.UserPatch, version int64) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Usecase.PatchUser")
+	defer span.End()
+	return uc.userRepo.Patch(ctx, id, patch, version)
+}
+
 func (uc *UserUsecase) GetUser(ctx context.Context, id string) (*models.User, error) {
 	ctx, span := tracing.Start(ctx, "Usecase.GetUser")
 	defer span.End()
 	return uc.userRepo.Get(ctx, id)
 }
 
-func (uc *UserUsecase) DeleteUser(ctx context.Context, id string) error {
+// DeleteUser soft-deletes the user, only while it is at version unless
+// version is zero.
+func (uc *UserUsecase) DeleteUser(ctx context.Context, id string, version int64) error {
 	ctx, span := tracing.Start(ctx, "Usecase.DeleteUser")
 	defer span.End()
+	if version != 0 {
+		return uc.userRepo.DeleteIfVersion(ctx, id, version)
+	}
 	return uc.userRepo.Delete(ctx, id)
 }
+
+// RestoreUser undoes the soft delete of a user.
+func (uc *UserUsecase) RestoreUser(ctx context.Context, id string) (*models.User, error) {
+	ctx, span := tracing.Start(ctx, "Usecase.RestoreUser")
+	defer span.End()
+	return uc.userRepo.Restore(ctx, id)
+}
+
+func (uc *UserUsecase) CreateUsers(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	ctx, span := tracing.Start(ctx, "Usecase.CreateUsers")
+	defer span.End()
+	return uc.userRepo.CreateMany(ctx, users, mode)
+}
+
+func (uc *UserUsecase) UpdateUsers(ctx context.Context, users []*models.User, mode models.BulkMode) ([]models.BulkResult, error) {
+	ctx, span := tracing.Start(ctx, "Usecase.UpdateUsers")
+	defer span.End()
+	return uc.userRepo.UpdateMany(ctx, users, mode)
+}
+
+func (uc *UserUsecase) DeleteUsers(ctx context.Context, ids []string, mode models.BulkMode) ([]models.BulkResult, error) {
+	ctx, span := tracing.Start(ctx, "Usecase.DeleteUsers")
+	defer span.End()
+	return uc.userRepo.DeleteMany(ctx, ids, mode)
+}
+
+func (uc *UserUsecase) ExportUsers(ctx context.Context, filter models.UserFilter, fn func(*models.User) error) error {
+	ctx, span := tracing.Start(ctx, "Usecase.ExportUsers")
+	defer span.End()
+	return uc.userRepo.Export(ctx, filter, fn)
+}